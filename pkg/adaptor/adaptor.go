@@ -2,6 +2,7 @@ package adaptor
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
@@ -13,6 +14,7 @@ import (
 	"unsafe"
 
 	"github.com/DevNewbie1826/hon/pkg/appcontext"
+	"github.com/DevNewbie1826/hon/pkg/engine/parser"
 	"github.com/cloudwego/netpoll"
 )
 
@@ -26,6 +28,12 @@ type Hijacker interface {
 	SetReadHandler(handler ReadHandler)
 }
 
+// tlsConnectionStater is implemented by connections that terminate TLS.
+// tlsConnectionStater는 TLS를 종료하는 연결이 구현합니다.
+type tlsConnectionStater interface {
+	TLSConnectionState() *tls.ConnectionState
+}
+
 // currentDate holds the cached Date header value.
 // currentDate는 캐시된 Date 헤더 값을 저장합니다.
 var currentDate atomic.Value
@@ -55,6 +63,7 @@ type ResponseWriter struct {
 	hijacked   bool                       // Indicates if the connection has been hijacked. // 연결이 하이재킹되었는지 나타냅니다.
 	headerSent bool                       // Indicates if headers have already been sent. // 헤더가 이미 전송되었는지 나타냅니다.
 	chunked    bool                       // Indicates if chunked transfer encoding is used. // 청크 전송 인코딩이 사용되는지 나타냅니다.
+	headBytes  int64                      // Body bytes written and dropped for a HEAD request. // HEAD 요청에 대해 쓰여지고 버려진 본문 바이트 수입니다.
 	bufWriter  *bufio.Writer              // Buffering for efficient writes. // 효율적인 쓰기를 위한 버퍼입니다.
 }
 
@@ -88,6 +97,7 @@ func NewResponseWriter(ctx *appcontext.RequestContext, req *http.Request) *Respo
 	w.hijacked = false
 	w.headerSent = false
 	w.chunked = false
+	w.headBytes = 0
 
 	// Get bufio.Writer from context (injected by engine)
 	// 컨텍스트에서 bufio.Writer를 가져옵니다 (엔진에 의해 주입됨).
@@ -109,6 +119,7 @@ func (w *ResponseWriter) Release() {
 	w.hijacked = false
 	w.headerSent = false
 	w.chunked = false
+	w.headBytes = 0
 
 	// Clear headers
 	// 헤더를 초기화합니다.
@@ -127,7 +138,42 @@ func GetRequest(ctx *appcontext.RequestContext) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	setConnInfo(ctx, req)
+	return req, nil
+}
+
+// ParseRequest is like GetRequest but parses the request in a single pass with
+// parser.ParseRequest, reusing r's storage instead of allocating a new request.
+// Requests the native parser leaves to net/http are read with http.ReadRequest.
+// The returned request is only valid until r is parsed into again.
+// ParseRequest는 GetRequest와 같지만 네이티브 파서로 r에 요청을 파싱하여 메모리를 재사용합니다.
+func ParseRequest(ctx *appcontext.RequestContext, r *parser.Request) (*http.Request, error) {
+	br := ctx.GetReader()
+	if _, err := br.Peek(1); err != nil {
+		return nil, err
+	}
+	buf, _ := br.Peek(br.Buffered())
+
+	var req *http.Request
+	n, err := parser.ParseRequest(buf, r)
+	switch err {
+	case nil:
+		_, _ = br.Discard(n)
+		r.SetBody(br)
+		req = &r.Request
+	case parser.ErrIncomplete, parser.ErrUnsupported:
+		if req, err = http.ReadRequest(br); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	setConnInfo(ctx, req)
+	return req, nil
+}
 
+// setConnInfo fills the request fields that come from the connection.
+func setConnInfo(ctx *appcontext.RequestContext, req *http.Request) {
 	// Set RemoteAddr
 	// 원격 주소를 설정합니다.
 	if remoteAddr := ctx.RemoteAddr(); remoteAddr != "" {
@@ -136,7 +182,11 @@ func GetRequest(ctx *appcontext.RequestContext) (*http.Request, error) {
 		req.RemoteAddr = addr.String()
 	}
 
-	return req, nil
+	// Expose the negotiated TLS state (e.g. engine.TLSConn).
+	// 협상된 TLS 상태를 노출합니다.
+	if tc, ok := ctx.Conn().(tlsConnectionStater); ok {
+		req.TLS = tc.TLSConnectionState()
+	}
 }
 
 func (w *ResponseWriter) Header() http.Header {
@@ -181,6 +231,13 @@ func (w *ResponseWriter) Write(p []byte) (int, error) {
 		return 0, nil
 	}
 
+	if skip, err := w.discardBody(p); skip {
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
 	if !w.headerSent {
 		// Sniff Content-Type if not set
 		// Content-Type이 설정되지 않았다면 응답 본문의 첫 512바이트를 기반으로 Content-Type을 감지합니다.
@@ -220,6 +277,14 @@ func (w *ResponseWriter) ReadFrom(r io.Reader) (n int64, err error) {
 	if w.hijacked {
 		return 0, http.ErrHijacked
 	}
+	if !w.bodyAllowed() {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if w.isHead() {
+		n, err = io.Copy(io.Discard, r)
+		w.headBytes += n
+		return n, err
+	}
 
 	if !w.headerSent {
 		if err := w.ensureHeaderSent(); err != nil {
@@ -340,13 +405,32 @@ func (w *ResponseWriter) ensureHeaderSent() error {
 		}
 	}
 
+	// Server shutdown: tell the client this connection will not be reused.
+	// 서버 종료 중: 이 연결이 재사용되지 않음을 클라이언트에 알립니다.
+	if w.ctx.Draining() {
+		w.header.Set("Connection", "close")
+	}
+
+	// The client is still waiting for "100 Continue" and has not sent the body,
+	// so the connection cannot be reused after this response.
+	// 클라이언트가 본문을 보내지 않았으므로 이 응답 후 연결을 재사용할 수 없습니다.
+	if w.ctx.DeclineContinue() {
+		w.header.Set("Connection", "close")
+		w.req.Close = true
+	}
+
 	hasTrailers := len(w.trailer) > 0
 
-	// If Content-Length is not set, we must use chunked encoding because we are streaming.
-	if w.header.Get(headerContentLength) == "" || hasTrailers {
-		w.chunked = true
+	switch {
+	case w.isHead() || !w.bodyAllowed():
+		// No body follows, so there is nothing to frame.
+		// 본문이 없으므로 프레이밍할 것이 없습니다.
+		w.chunked = false
+	case w.header.Get(headerContentLength) == "" || hasTrailers:
+		// If Content-Length is not set, we must use chunked encoding because we are streaming.
 		// If Content-Length is explicitly set, but trailers are present, we still enforce chunked encoding.
-	} else {
+		w.chunked = true
+	default:
 		w.chunked = false
 	}
 
@@ -496,7 +580,16 @@ func (w *ResponseWriter) EndResponse() error {
 	// If headers not sent yet, it means no body was written.
 	// 헤더가 아직 전송되지 않았다면 바디가 없었다는 의미입니다.
 	if !w.headerSent {
-		w.header.Set("Content-Length", "0")
+		switch {
+		case w.isHead():
+			// Announce the length the GET response would have had, if the handler wrote it.
+			// 핸들러가 본문을 썼다면 GET 응답의 길이를 알립니다.
+			if w.headBytes > 0 && w.header.Get(headerContentLength) == "" {
+				w.header.Set(headerContentLength, strconv.FormatInt(w.headBytes, 10))
+			}
+		case w.bodyAllowed():
+			w.header.Set("Content-Length", "0")
+		}
 		// Fallback to ensuring headers are sent, which will also set Chunked if needed.
 		// 이 경우 Content-Length: 0이므로 Chunked가 아님.
 		if err := w.ensureHeaderSent(); err != nil {
@@ -526,11 +619,48 @@ func (w *ResponseWriter) EndResponse() error {
 		}
 	}
 
+	// The server batches this response with the next ones and flushes them together.
+	// 서버가 이 응답을 다음 응답들과 묶어 함께 플러시합니다.
+	if w.ctx.FlushDeferred() {
+		return nil
+	}
+
 	// Flush any remaining buffered data
 	// 버퍼링된 남은 데이터를 플러시합니다.
 	return w.bufWriter.Flush()
 }
 
+// isHead reports whether the response answers a HEAD request.
+// isHead는 응답이 HEAD 요청에 대한 것인지 여부를 반환합니다.
+func (w *ResponseWriter) isHead() bool {
+	return w.req != nil && w.req.Method == http.MethodHead
+}
+
+// bodyAllowed reports whether the status code permits a response body (RFC 9110 §6.4.1).
+// bodyAllowed는 상태 코드가 응답 본문을 허용하는지 여부를 반환합니다.
+func (w *ResponseWriter) bodyAllowed() bool {
+	s := w.statusCode
+	return !(s >= 100 && s < 200 || s == http.StatusNoContent || s == http.StatusNotModified)
+}
+
+// discardBody absorbs body writes for responses that carry none, reporting whether p was
+// consumed. As in net/http, HEAD responses drop them but keep their length and sniffed
+// Content-Type so the headers match GET, and statuses without a body reject them.
+// discardBody는 본문이 없는 응답에 대한 쓰기를 처리하고 p가 소비되었는지 반환합니다.
+func (w *ResponseWriter) discardBody(p []byte) (bool, error) {
+	if !w.bodyAllowed() {
+		return true, http.ErrBodyNotAllowed
+	}
+	if !w.isHead() {
+		return false, nil
+	}
+	if !w.headerSent && w.headBytes == 0 && w.header.Get("Content-Type") == "" {
+		w.header.Set("Content-Type", http.DetectContentType(p[:min(len(p), 512)]))
+	}
+	w.headBytes += int64(len(p))
+	return true, nil
+}
+
 // -----------------------------------------------------------------------------
 // Optional Interfaces Implementation for http.ResponseController & Compatibility
 // -----------------------------------------------------------------------------
@@ -613,6 +743,13 @@ func (w *ResponseWriter) WriteString(s string) (int, error) {
 		return 0, nil
 	}
 
+	if skip, err := w.discardBody(unsafe.Slice(unsafe.StringData(s), len(s))); skip {
+		if err != nil {
+			return 0, err
+		}
+		return len(s), nil
+	}
+
 	if !w.headerSent {
 		// Sniff Content-Type if not set
 		if w.header.Get("Content-Type") == "" && len(s) > 0 {
@@ -7,9 +7,11 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/DevNewbie1826/hon/pkg/appcontext"
+	"github.com/DevNewbie1826/hon/pkg/engine/parser"
 	"github.com/cloudwego/netpoll"
 )
 
@@ -109,6 +111,79 @@ func TestGetRequest_DoesNotInheritParentContext(t *testing.T) {
 	}
 }
 
+func TestParseRequest_ReusesStorageAndFallsBack(t *testing.T) {
+	raw := bytes.NewBufferString("POST /a HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\nhi" +
+		"GET /b HTTP/1.2\r\nHost: localhost\r\n\r\n")
+	ctx := appcontext.NewRequestContext(nil, context.Background(), bufio.NewReader(raw), bufio.NewWriter(io.Discard))
+	ctx.SetRemoteAddr("127.0.0.1:1234")
+	defer ctx.Release()
+
+	var storage parser.Request
+	req, err := ParseRequest(ctx, &storage)
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if req != &storage.Request {
+		t.Error("expected the request to be parsed into the provided storage")
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != "hi" || req.RemoteAddr != "127.0.0.1:1234" {
+		t.Errorf("unexpected request: body %q, remote %q", body, req.RemoteAddr)
+	}
+
+	// HTTP/1.2 is left to net/http.
+	req, err = ParseRequest(ctx, &storage)
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if req == &storage.Request || req.URL.Path != "/b" || req.ProtoMinor != 2 || req.RemoteAddr != "127.0.0.1:1234" {
+		t.Errorf("unexpected fallback request %+v", req)
+	}
+}
+
+func TestResponseWriter_BodilessResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		status  int
+		body    string
+		wantErr error
+		want    string
+	}{
+		{"HEAD with body", http.MethodHead, http.StatusOK, "hello", nil,
+			"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n"},
+		{"HEAD without body", http.MethodHead, http.StatusOK, "", nil, "HTTP/1.1 200 OK\r\n\r\n"},
+		{"204", http.MethodGet, http.StatusNoContent, "x", http.ErrBodyNotAllowed, "HTTP/1.1 204 No Content\r\n\r\n"},
+		{"304", http.MethodGet, http.StatusNotModified, "x", http.ErrBodyNotAllowed, "HTTP/1.1 304 Not Modified\r\n\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			bw := bufio.NewWriter(buf)
+			ctx := appcontext.NewRequestContext(nil, context.Background(), nil, bw)
+			rw := NewResponseWriter(ctx, &http.Request{Method: tt.method})
+			rw.WriteHeader(tt.status)
+			if tt.body != "" {
+				if _, err := rw.Write([]byte(tt.body)); err != tt.wantErr {
+					t.Errorf("Write error = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if err := rw.EndResponse(); err != nil {
+				t.Fatalf("EndResponse failed: %v", err)
+			}
+			rw.Release()
+
+			// Drop the Date line, whose value varies.
+			got := buf.String()
+			if i := strings.Index(got, "Date: "); i >= 0 {
+				got = got[:i] + got[i+strings.Index(got[i:], "\r\n")+2:]
+			}
+			if got != tt.want {
+				t.Errorf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && bytes.Contains([]byte(s), []byte(substr))
 }
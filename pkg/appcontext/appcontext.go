@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/cloudwego/netpoll"
 )
@@ -20,6 +21,9 @@ type RequestContext struct {
 	reader           *bufio.Reader      // Reusable buffered reader for the connection. // 연결을 위한 재사용 가능한 버퍼링된 리더입니다.
 	writer           *bufio.Writer      // Reusable buffered writer for the connection. // 연결을 위한 재사용 가능한 버퍼링된 라이터입니다.
 	remoteAddr       string             // Cached remote address string for repeated requests on the same connection.
+	draining         *atomic.Bool       // Connection-level drain flag set during server shutdown. // 서버 종료 중 설정되는 연결 수준 드레인 플래그입니다.
+	expectContinue   *atomic.Bool       // Set while the client waits for "100 Continue". // 클라이언트가 100 Continue를 기다리는 동안 설정됩니다.
+	flushDeferred    bool               // The server flushes the response itself, batched with others. // 서버가 다른 응답과 묶어 직접 플러시합니다.
 	onSetReadHandler func(ReadHandler)  // Callback for when a custom read handler is set. // 사용자 정의 읽기 핸들러가 설정될 때 호출되는 콜백입니다.
 }
 
@@ -71,6 +75,9 @@ func (c *RequestContext) reset() {
 	c.reader = nil
 	c.writer = nil
 	c.remoteAddr = ""
+	c.draining = nil
+	c.expectContinue = nil
+	c.flushDeferred = false
 	c.onSetReadHandler = nil
 }
 
@@ -105,3 +112,43 @@ func (c *RequestContext) SetRemoteAddr(addr string) {
 func (c *RequestContext) RemoteAddr() string {
 	return c.remoteAddr
 }
+
+// SetDraining links the connection's drain flag to this context.
+// SetDraining은 연결의 드레인 플래그를 이 컨텍스트에 연결합니다.
+func (c *RequestContext) SetDraining(flag *atomic.Bool) {
+	c.draining = flag
+}
+
+// Draining reports whether the server is shutting down and the connection
+// should be closed after the current response.
+// Draining은 서버가 종료 중이어서 현재 응답 후 연결을 닫아야 하는지 여부를 반환합니다.
+func (c *RequestContext) Draining() bool {
+	return c != nil && c.draining != nil && c.draining.Load()
+}
+
+// SetFlushDeferred tells the response writer to leave the final flush of each response
+// to the server, which batches the responses to pipelined requests into fewer writes.
+// SetFlushDeferred는 응답의 마지막 플러시를 서버에 맡기도록 설정합니다(파이프라인 응답 일괄 전송).
+func (c *RequestContext) SetFlushDeferred(deferred bool) {
+	c.flushDeferred = deferred
+}
+
+// FlushDeferred reports whether the server flushes completed responses itself.
+// FlushDeferred는 서버가 완료된 응답을 직접 플러시하는지 여부를 반환합니다.
+func (c *RequestContext) FlushDeferred() bool {
+	return c != nil && c.flushDeferred
+}
+
+// SetExpectContinue links the request's pending "100 Continue" flag to this context.
+// SetExpectContinue는 요청의 대기 중인 "100 Continue" 플래그를 이 컨텍스트에 연결합니다.
+func (c *RequestContext) SetExpectContinue(flag *atomic.Bool) {
+	c.expectContinue = flag
+}
+
+// DeclineContinue withdraws a pending "100 Continue" because a final response is
+// being sent first. It reports whether one was pending, in which case the client
+// has not sent the body and the connection must not be reused.
+// DeclineContinue는 최종 응답이 먼저 전송되므로 대기 중인 "100 Continue"를 철회합니다.
+func (c *RequestContext) DeclineContinue() bool {
+	return c != nil && c.expectContinue != nil && c.expectContinue.CompareAndSwap(true, false)
+}
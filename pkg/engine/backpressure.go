@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cloudwego/netpoll"
+)
+
+// DefaultStreamingBodyBuffer is how much of a streamed request body the engine reads
+// ahead of the handler by default.
+const DefaultStreamingBodyBuffer = 256 << 10 // 256KB
+
+// WithStreamingBodyBuffer sets how many bytes of a streamed request body may be buffered
+// ahead of the handler (see WithStreamingBody). Once the reactor holds that much, the
+// connection is taken out of the poller's read set and the client is held back by TCP
+// flow control; reading resumes when the handler has consumed half of it. The default
+// is DefaultStreamingBodyBuffer.
+// WithStreamingBodyBuffer는 핸들러보다 앞서 버퍼링할 수 있는 스트리밍 본문의 최대 바이트 수를 설정합니다.
+func WithStreamingBodyBuffer(n int) Option {
+	return func(e *Engine) {
+		e.streamBuffer = n
+	}
+}
+
+// PrepareConn readies a connection accepted by netpoll for the engine. It must be
+// called from netpoll's OnPrepare callback, before the connection is registered with
+// its poller: with WithStreamingBody, it hooks the reactor's reads so streamed bodies
+// can pause them.
+// PrepareConn은 netpoll이 수락한 연결을 엔진에 맞게 준비합니다(OnPrepare에서 호출해야 합니다).
+func (e *Engine) PrepareConn(conn netpoll.Connection, state *ConnectionState) {
+	if !e.streamBody {
+		return
+	}
+	state.gate.install(conn)
+}
+
+// readGate stops the reactor from reading a connection while a streamed body has more
+// buffered than the handler has asked for. netpoll reads every readable connection into
+// its buffer and offers no way to pause that, so the gate wraps the poller's read
+// callback and removes the descriptor from the poller while the buffer is full.
+// It is embedded in ConnectionState, so installing it does not allocate.
+type readGate struct {
+	conn netpoll.Connection
+	poll netpoll.Poll
+	op   *netpoll.FDOperator
+	ack  func(n int) error // netpoll's own read callback.
+
+	limit  atomic.Int64 // High-water mark while a streamed body is being read; 0 otherwise.
+	mu     sync.Mutex
+	paused bool // Guarded by mu.
+}
+
+// pollOffset locates the poll an operator is registered with, which netpoll keeps
+// private. ok is false if this version of netpoll lays it out differently, in which
+// case reading is never paused.
+var pollOffset = sync.OnceValues(func() (uintptr, bool) {
+	f, found := reflect.TypeOf(netpoll.FDOperator{}).FieldByName("poll")
+	if !found || f.Type != reflect.TypeOf((*netpoll.Poll)(nil)).Elem() {
+		return 0, false
+	}
+	return f.Offset, true
+})
+
+// connOperator caches operatorOffset by connection type.
+var connOperator sync.Map // reflect.Type -> uintptr
+
+// operatorOffset locates the operator that registers conn with its poller.
+func operatorOffset(conn netpoll.Connection) (uintptr, bool) {
+	t := reflect.TypeOf(conn)
+	if off, ok := connOperator.Load(t); ok {
+		return off.(uintptr), true
+	}
+	if t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return 0, false
+	}
+	f, found := t.Elem().FieldByName("operator")
+	if !found || f.Type != reflect.TypeOf((*netpoll.FDOperator)(nil)) {
+		return 0, false
+	}
+	connOperator.Store(t, f.Offset)
+	return f.Offset, true
+}
+
+// install hooks the gate into conn's poller registration. The poller only reads the
+// operator once the connection is registered, so replacing its callback here is safe.
+func (g *readGate) install(conn netpoll.Connection) {
+	pollOff, ok := pollOffset()
+	if !ok {
+		return
+	}
+	off, ok := operatorOffset(conn)
+	if !ok {
+		return
+	}
+	op := *(**netpoll.FDOperator)(unsafe.Add(reflect.ValueOf(conn).UnsafePointer(), off))
+	if op == nil || op.InputAck == nil {
+		return
+	}
+	g.conn, g.op, g.ack = conn, op, op.InputAck
+	g.poll = *(*netpoll.Poll)(unsafe.Add(unsafe.Pointer(op), pollOff))
+	op.InputAck = g.inputAck
+}
+
+// installed reports whether the gate can pause reading.
+func (g *readGate) installed() bool {
+	return g.op != nil
+}
+
+// inputAck runs on the poller after it has read n bytes into the connection's buffer.
+func (g *readGate) inputAck(n int) error {
+	err := g.ack(n)
+	// A resume in progress waits for this callback to finish, so it is not waited for;
+	// the next read checks again.
+	if limit := g.limit.Load(); limit > 0 && int64(g.conn.Reader().Len()) >= limit && g.mu.TryLock() {
+		if !g.paused && g.limit.Load() > 0 && g.poll.Control(g.op, netpoll.PollDetach) == nil {
+			g.paused = true
+		}
+		g.mu.Unlock()
+	}
+	return err
+}
+
+// open starts holding a streamed body to limit buffered bytes.
+func (g *readGate) open(limit int) {
+	g.limit.Store(int64(limit))
+}
+
+// consumed resumes reading once the handler has taken the buffer below half the limit.
+// An empty buffer always resumes it, so a handler never waits on a paused connection.
+func (g *readGate) consumed() {
+	if n := int64(g.conn.Reader().Len()); n > 0 && n >= g.limit.Load()/2 {
+		return
+	}
+	g.resume()
+}
+
+// close stops holding the body back, so the connection is read again.
+func (g *readGate) close() {
+	g.limit.Store(0)
+	g.resume()
+}
+
+func (g *readGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		// The descriptor stays open while the request is served, so it cannot have been
+		// reused by another connection.
+		_ = g.poll.Control(g.op, netpoll.PollReadable)
+		g.paused = false
+	}
+}
+
+// reset forgets the connection the gate was installed on.
+func (g *readGate) reset() {
+	g.conn, g.poll, g.op, g.ack = nil, nil, nil, nil
+	g.limit.Store(0)
+	g.paused = false
+}
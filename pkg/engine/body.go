@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cloudwego/netpoll"
+)
+
+// bodyTooLargeResponse is written before closing a connection whose request
+// declares a body larger than the engine-wide limit.
+var bodyTooLargeResponse = []byte("HTTP/1.1 413 Content Too Large\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+
+// continueResponse is the interim response to "Expect: 100-continue".
+var continueResponse = []byte("HTTP/1.1 100 Continue\r\n\r\n")
+
+// WithImmediateContinue controls when "100 Continue" is sent to clients that ask for it.
+// By default the handler is called once the headers are in and the interim response is
+// sent when it first reads req.Body, so a handler can refuse the request with a final
+// status before the body is transmitted. When enabled, the engine sends it as soon as
+// the headers arrive and then waits for the body as usual.
+// WithImmediateContinue는 "100 Continue" 전송 시점을 제어합니다. 기본값은 핸들러가
+// req.Body를 처음 읽을 때 전송하며, 활성화하면 헤더 수신 즉시 전송합니다.
+func WithImmediateContinue(enabled bool) Option {
+	return func(e *Engine) {
+		e.immediateContinue = enabled
+	}
+}
+
+// WithMaxRequestBodySize caps request bodies at n bytes. Requests whose Content-Length
+// or chunk sizes exceed it get "413 Content Too Large" as soon as the reactor sees them,
+// before the body is buffered. The default is no limit.
+// WithMaxRequestBodySize는 요청 본문 크기를 n 바이트로 제한합니다. 초과하는 요청은
+// 본문을 버퍼링하기 전에 413 응답을 받습니다.
+func WithMaxRequestBodySize(n int64) Option {
+	return func(e *Engine) {
+		e.parser.MaxBodySize = n
+	}
+}
+
+// WithPathMaxRequestBodySize gives requests whose URL path starts with prefix a body
+// limit of n bytes in place of the WithMaxRequestBodySize one, which remains the default
+// for other paths. The reactor applies it as it frames the request, so an upload route
+// can accept more than the rest of the server and still gets the early 413. The longest
+// matching prefix wins; paths are matched as sent, before percent-decoding. n = 0 means
+// no limit.
+// WithPathMaxRequestBodySize는 URL 경로가 prefix로 시작하는 요청의 본문 크기 제한을 n 바이트로 설정합니다.
+func WithPathMaxRequestBodySize(prefix string, n int64) Option {
+	return func(e *Engine) {
+		e.pathBodyLimits = append(e.pathBodyLimits, pathBodyLimit{prefix: prefix, limit: n})
+	}
+}
+
+// pathBodyLimit gives requests under prefix their own body size limit.
+type pathBodyLimit struct {
+	prefix string
+	limit  int64
+}
+
+// rootPath is the path of an absolute-form request target without one.
+var rootPath = []byte("/")
+
+// maxBodySizeFor returns the body size limit for a request target: that of the longest
+// WithPathMaxRequestBodySize prefix matching its path, or the engine-wide one.
+func (e *Engine) maxBodySizeFor(target []byte) int64 {
+	path := target
+	if len(path) > 0 && path[0] != '/' {
+		// Absolute form: scheme://authority/path.
+		if i := bytes.Index(path, []byte("://")); i != -1 {
+			path = path[i+3:]
+			if j := bytes.IndexByte(path, '/'); j != -1 {
+				path = path[j:]
+			} else {
+				path = rootPath
+			}
+		}
+	}
+	if q := bytes.IndexByte(path, '?'); q != -1 {
+		path = path[:q]
+	}
+	limit, matched := e.parser.MaxBodySize, -1
+	for _, pl := range e.pathBodyLimits {
+		if len(pl.prefix) > matched && len(path) >= len(pl.prefix) && string(path[:len(pl.prefix)]) == pl.prefix {
+			limit, matched = pl.limit, len(pl.prefix)
+		}
+	}
+	return limit
+}
+
+// WithStreamingBody makes the engine call the handler as soon as a request's headers
+// have arrived instead of waiting for the whole body. Reads from req.Body then block
+// until the reactor delivers more data, bounded by the connection's read timeout and
+// WithMinBodyRate, so large uploads are processed as they arrive. The reactor reads
+// at most WithStreamingBodyBuffer bytes ahead of the handler; beyond that the socket is
+// left unread, so a client uploading faster than the handler consumes is slowed down
+// by TCP flow control instead of filling memory. Servers call PrepareConn for this.
+// WithStreamingBody는 본문 전체를 기다리지 않고 헤더가 도착하는 즉시 핸들러를 호출하도록 합니다.
+// req.Body 읽기는 리액터가 데이터를 전달할 때까지 블록됩니다.
+func WithStreamingBody(enabled bool) Option {
+	return func(e *Engine) {
+		e.streamBody = enabled
+	}
+}
+
+// SetMaxRequestBodySize overrides the body size limit for the request served on ctx,
+// typically from a handler that knows more about the request than its path. Reads past
+// n fail with *http.MaxBytesError and, on HTTP/1, the connection is closed after the
+// response. The reactor has already held the declared length, and the chunks it saw
+// before the handler ran, to the limit for the request's path; to let a route accept
+// more than that, raise it with WithPathMaxRequestBodySize. On HTTP/2 the limit belongs
+// to the stream, so concurrent requests on a connection each keep their own. It reports
+// false if ctx does not belong to a request with a body served by an Engine.
+// SetMaxRequestBodySize는 ctx의 요청에 대한 본문 크기 제한을 재정의합니다.
+func SetMaxRequestBodySize(ctx context.Context, n int64) bool {
+	if s, ok := ctx.Value(h2StreamKey{}).(*h2Stream); ok {
+		return s.setBodyLimit(n)
+	}
+	state, ok := ctx.Value(CtxKeyConnectionState).(*ConnectionState)
+	if !ok || state.body.rc == nil {
+		return false
+	}
+	state.body.limit = n
+	return true
+}
+
+// limitedBody enforces the per-request body size limit. It is embedded in
+// ConnectionState so wrapping a request body does not allocate.
+// When the body is streamed, it also holds blocking reads to the minimum body rate.
+type limitedBody struct {
+	rc       io.ReadCloser
+	limit    int64 // Zero or negative means no limit.
+	read     int64
+	exceeded bool
+	state    *ConnectionState
+
+	// Set when streaming with a minimum body rate.
+	engine *Engine
+	conn   netpoll.Connection
+	waited time.Duration // Time spent blocked waiting for the client.
+
+	gate *readGate // Set when streaming; resumed as the body is consumed.
+}
+
+// wrapBody installs the size-limiting reader around req.Body, with the limit the
+// request was framed with.
+func (e *Engine) wrapBody(req *http.Request, conn netpoll.Connection, state *ConnectionState) {
+	if req.Body == nil || req.Body == http.NoBody {
+		state.body = limitedBody{}
+		return
+	}
+	state.body = limitedBody{rc: req.Body, limit: state.bodyLimit, state: state}
+	if e.streamBody && e.minBodyRate > 0 {
+		state.body.engine, state.body.conn = e, conn
+	}
+	if e.streamBody && state.gate.installed() {
+		state.gate.open(e.streamBuffer)
+		state.body.gate = &state.gate
+	}
+	req.Body = &state.body
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	// The client holds the body back until it is told to continue.
+	if b.state.expect.CompareAndSwap(true, false) {
+		b.state.sendContinue()
+	}
+	if b.limit > 0 {
+		if b.read >= b.limit {
+			// Distinguish a body that ends exactly at the limit from one that goes past it.
+			var one [1]byte
+			if n, _ := b.readPaced(one[:]); n == 0 {
+				return 0, io.EOF
+			}
+			b.exceeded = true
+			return 0, &http.MaxBytesError{Limit: b.limit}
+		}
+		if remaining := b.limit - b.read; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := b.readPaced(p)
+	b.read += int64(n)
+	if b.gate != nil {
+		b.gate.consumed()
+	}
+	return n, err
+}
+
+// readPaced reads from the body. When pacing, the time the client may keep a read
+// blocked is what remains of grace+read/rate after earlier waits, so time the handler
+// spends between reads does not count against the client.
+func (b *limitedBody) readPaced(p []byte) (int, error) {
+	if b.engine == nil {
+		return b.rc.Read(p)
+	}
+	e := b.engine
+	start := time.Now()
+	allowance := e.bodyRateGrace + time.Duration(float64(b.read)/e.minBodyRate*float64(time.Second)) - b.waited
+	e.setReadDeadline(b.conn, b.state, allowance)
+	n, err := b.rc.Read(p)
+	b.state.readTimer.stop()
+	b.waited += time.Since(start)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+// sendContinue writes the "100 Continue" interim response.
+func (s *ConnectionState) sendContinue() {
+	_, _ = s.Writer.Write(continueResponse)
+	_ = s.Writer.Flush()
+	s.continued = true
+}
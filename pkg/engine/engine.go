@@ -6,7 +6,8 @@ import (
 	"context"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"strings"
@@ -17,6 +18,7 @@ import (
 	"github.com/DevNewbie1826/hon/pkg/adaptor"
 	"github.com/DevNewbie1826/hon/pkg/appcontext"
 	"github.com/DevNewbie1826/hon/pkg/engine/parser"
+	"github.com/DevNewbie1826/hon/pkg/engine/proxyproto"
 	"github.com/cloudwego/netpoll"
 )
 
@@ -29,24 +31,53 @@ var connectionStatePool = sync.Pool{
 }
 
 type ConnectionState struct {
+	ID          uint64 // Process-unique connection ID, for logs.
 	Reader      *bufio.Reader
 	Writer      *bufio.Writer
 	ReadHandler appcontext.ReadHandler
 	CancelFunc  context.CancelFunc
 	ReadTimeout time.Duration
 	RemoteAddr  string
+	LocalAddr   net.Addr
+	TLS         *TLSConn           // Non-nil when the connection is served over TLS.
+	ProxyMode   proxyproto.Mode    // PROXY protocol handling; reset to Off once the header is consumed.
+	Proxy       *proxyproto.Header // Parsed PROXY protocol header, if any.
 	Processing  atomic.Bool
-	refCount    int32 // Reference count for safe resource release
+	Hijacked    atomic.Bool            // Set once a handler hijacks the connection.
+	Draining    atomic.Bool            // Set by the server during shutdown; responses carry Connection: close.
+	refCount    int32                  // Reference count for safe resource release
+	served      uint64                 // Requests served on this connection, for keep-alive reuse stats.
+	connState   http.ConnState         // Last state reported to the ConnState hook; guarded by connStateMu.
+	readTimer   *readTimer             // Enforces the header timeout and minimum body rate.
+	reqStart    time.Time              // When the pending request's first bytes were seen.
+	bodyStart   time.Time              // When the pending request's headers were complete.
+	body        limitedBody            // Size-limited wrapper around the current request body.
+	bodyLimit   int64                  // Body size limit the current request was framed with.
+	expect      atomic.Bool            // Set while the client waits for "100 Continue".
+	continued   bool                   // "100 Continue" was sent for the current request.
+	sample      []byte                 // Start of the current request, kept for the parse error hook.
+	request     parser.Request         // Reused storage for the request being served.
+	framing     parser.Framing         // Progress through the request being received.
+	pipelined   int                    // Requests served back to back since the client last had none waiting.
+	h2          atomic.Pointer[h2Conn] // HTTP/2 session, once the connection has switched to h2c.
+	gate        readGate               // Pauses reading while a streamed body is buffered ahead of the handler.
+	counter     countingConn
 	done        chan struct{}
 	err         error
 	cancelMu    sync.RWMutex
+	connStateMu sync.Mutex
 }
 
+// nextConnID generates ConnectionState.ID values.
+var nextConnID atomic.Uint64
+
 func NewConnectionState(readTimeout time.Duration) *ConnectionState {
 	s := connectionStatePool.Get().(*ConnectionState)
 	s.cancelMu.Lock()
+	s.ID = nextConnID.Add(1)
 	s.ReadTimeout = readTimeout
 	s.refCount = 1 // Initial reference held by the connection (OnPrepare)
+	s.connState = connStateUnknown
 	s.done = make(chan struct{})
 	s.err = nil
 	s.cancelMu.Unlock()
@@ -59,14 +90,40 @@ func (s *ConnectionState) Reset() {
 	// so using non-atomic assignments is safe.
 	s.cancelMu.Lock()
 	defer s.cancelMu.Unlock()
+	s.ID = 0
 	s.Reader = nil
 	s.Writer = nil
 	s.CancelFunc = nil
 	s.ReadHandler = nil
 	s.Processing.Store(false)
+	s.Hijacked.Store(false)
+	s.Draining.Store(false)
 	s.ReadTimeout = 0
 	s.RemoteAddr = ""
+	s.LocalAddr = nil
+	s.TLS = nil
+	s.ProxyMode = proxyproto.Off
+	s.Proxy = nil
 	s.refCount = 0
+	s.served = 0
+	s.connState = connStateUnknown
+	if s.readTimer != nil {
+		s.readTimer.stop()
+		s.readTimer = nil
+	}
+	s.reqStart = time.Time{}
+	s.bodyStart = time.Time{}
+	s.body = limitedBody{}
+	s.bodyLimit = 0
+	s.expect.Store(false)
+	s.continued = false
+	s.sample = s.sample[:0]
+	s.request.Reset()
+	s.framing.Reset()
+	s.pipelined = 0
+	s.h2.Store(nil)
+	s.gate.reset()
+	s.counter = countingConn{}
 	s.done = nil
 	s.err = nil
 }
@@ -92,24 +149,43 @@ func (s *ConnectionState) Err() error {
 
 // Value implements context.Context
 func (s *ConnectionState) Value(key any) any {
-	if key == CtxKeyConnectionState {
+	switch key {
+	case CtxKeyConnectionState:
 		return s
+	case http.LocalAddrContextKey:
+		if s.LocalAddr != nil {
+			return s.LocalAddr
+		}
 	}
 	return nil
 }
 
 // Cancel closes the done channel, simulating context cancellation.
+// HTTP/2 streams still running on the connection are failed too.
 func (s *ConnectionState) Cancel() {
 	s.cancelMu.Lock()
-	defer s.cancelMu.Unlock()
 	if s.err == nil {
 		s.err = context.Canceled
 		close(s.done)
 	}
+	s.cancelMu.Unlock()
+	if h := s.h2.Load(); h != nil {
+		h.abort()
+	}
 }
 
 var CtxKeyConnectionState = struct{}{}
 
+// ProxyHeader returns the PROXY protocol header of the connection serving ctx, if any.
+// Handlers can use it to read TLVs such as the original SNI (Header.Authority).
+// ProxyHeader는 ctx를 처리하는 연결의 PROXY 프로토콜 헤더를 반환합니다.
+func ProxyHeader(ctx context.Context) *proxyproto.Header {
+	if state, ok := ctx.Value(CtxKeyConnectionState).(*ConnectionState); ok {
+		return state.Proxy
+	}
+	return nil
+}
+
 type Option func(*Engine)
 
 func WithRequestTimeout(d time.Duration) Option {
@@ -130,14 +206,87 @@ func WithBufferSize(size int) Option {
 	}
 }
 
+// WithMaxHeaderSize sets the largest request header block accepted, in bytes.
+// Larger requests get "431 Request Header Fields Too Large". The default is parser.MaxHeaderSize.
+// WithMaxHeaderSize는 허용하는 요청 헤더 블록의 최대 크기(바이트)를 설정합니다.
+func WithMaxHeaderSize(n int) Option {
+	return func(e *Engine) {
+		e.parser.MaxHeaderSize = n
+	}
+}
+
+// WithMaxHeaderCount sets the largest number of header lines accepted per request.
+// Requests with more get "431 Request Header Fields Too Large". The default is no limit.
+// WithMaxHeaderCount는 요청당 허용하는 헤더 줄의 최대 개수를 설정합니다.
+func WithMaxHeaderCount(n int) Option {
+	return func(e *Engine) {
+		e.parser.MaxHeaderCount = n
+	}
+}
+
+// WithStrictParsing makes the engine reject requests whose framing is ambiguous with
+// "400 Bad Request": Content-Length together with Transfer-Encoding, repeated
+// Content-Length, Transfer-Encoding not ending in chunked, obs-folded headers and bare
+// LF line endings. This guarantees the reactor and net/http agree on where each
+// request ends, closing off request smuggling through front-end proxies.
+// WithStrictParsing은 프레이밍이 모호한 요청을 400으로 거부하도록 합니다(요청 스머글링 방지).
+func WithStrictParsing(enabled bool) Option {
+	return func(e *Engine) {
+		e.parser.Strict = enabled
+	}
+}
+
+// WithConnState registers a hook called as connections change state, mirroring
+// net/http's Server.ConnState: StateActive when a request starts, StateIdle once a
+// keep-alive response is done, StateHijacked on hijack. The server reports StateNew
+// on accept and StateClosed on close (except for hijacked connections).
+// The hook runs on the serving goroutine and must not block.
+// WithConnState는 연결 상태가 바뀔 때 호출되는 훅을 등록합니다(net/http의 Server.ConnState와 동일).
+func WithConnState(fn func(net.Conn, http.ConnState)) Option {
+	return func(e *Engine) {
+		e.connState = fn
+	}
+}
+
+// WithLogger sets the logger for panics and connection errors. Records carry
+// conn_id and remote_addr, plus method and path for handler panics.
+// Use logging.Discard to silence the engine or logging.RateLimit to throttle it.
+// The default is slog.Default().
+// WithLogger는 패닉과 연결 오류를 기록할 로거를 설정합니다.
+func WithLogger(l *slog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = l
+	}
+}
+
 type Engine struct {
 	Handler        http.Handler
 	requestTimeout time.Duration
 	maxDrainSize   int64
 	bufferSize     int
+	connState      func(net.Conn, http.ConnState)
+	parseErrorHook func(net.Conn, error, []byte)
+	logger         *slog.Logger
+
+	parser            parser.Config
+	streamBody        bool
+	streamBuffer      int
+	immediateContinue bool
+	readHeaderTimeout time.Duration
+	minBodyRate       float64
+	bodyRateGrace     time.Duration
+	maxPipelineDepth  int
+	batchFlush        bool
+	handlerLimit      *HandlerLimit
+	limiter           *AdaptiveLimiter
+	h2c               bool
+	pathLimits        []pathLimit
+	pathBodyLimits    []pathBodyLimit
 
 	readerPool sync.Pool
 	writerPool sync.Pool
+
+	stats engineStats
 }
 
 func NewEngine(handler http.Handler, opts ...Option) *Engine {
@@ -145,10 +294,19 @@ func NewEngine(handler http.Handler, opts ...Option) *Engine {
 		Handler:      handler,
 		maxDrainSize: MaxDrainSize,
 		bufferSize:   4096,
+		streamBuffer: DefaultStreamingBodyBuffer,
+		parser:       parser.Config{MaxHeaderSize: parser.MaxHeaderSize},
 	}
 	for _, opt := range opts {
 		opt(e)
 	}
+	if e.logger == nil {
+		e.logger = slog.Default()
+	}
+	if len(e.pathBodyLimits) > 0 {
+		e.parser.MaxBodySizeFor = e.maxBodySizeFor
+	}
+	e.stats.init()
 
 	e.readerPool = sync.Pool{
 		New: func() any {
@@ -164,6 +322,43 @@ func NewEngine(handler http.Handler, opts ...Option) *Engine {
 	return e
 }
 
+// connStateUnknown marks a connection that has not reported any state yet.
+const connStateUnknown http.ConnState = -1
+
+// ReportConnState passes a connection state change to the WithConnState hook.
+// Servers call it for transitions the engine does not observe (StateNew, StateClosed);
+// repeated reports of the same state and anything after StateHijacked or StateClosed
+// are dropped. The close callback may call it while a request is being served: the
+// hook is called for one report of a connection at a time, in the order they take effect.
+// ReportConnState는 연결 상태 변경을 WithConnState 훅에 전달합니다.
+func (e *Engine) ReportConnState(conn net.Conn, state *ConnectionState, cs http.ConnState) {
+	if e.connState == nil {
+		return
+	}
+	state.connStateMu.Lock()
+	defer state.connStateMu.Unlock()
+	if prev := state.connState; prev == cs || prev == http.StateHijacked || prev == http.StateClosed {
+		return
+	}
+	state.connState = cs
+	e.connState(conn, cs)
+}
+
+// logConn logs msg with the connection's ID and remote address.
+func (e *Engine) logConn(level slog.Level, msg string, conn net.Conn, state *ConnectionState, attrs ...slog.Attr) {
+	if !e.logger.Enabled(context.Background(), level) {
+		return
+	}
+	remote := state.RemoteAddr
+	if remote == "" {
+		if addr := conn.RemoteAddr(); addr != nil {
+			remote = addr.String()
+		}
+	}
+	attrs = append(attrs, slog.Uint64("conn_id", state.ID), slog.String("remote_addr", remote))
+	e.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
 // AcquireConnectionState increments the reference count.
 // Must be called when entering a goroutine that uses the state.
 func (e *Engine) AcquireConnectionState(s *ConnectionState) {
@@ -181,6 +376,12 @@ func (e *Engine) ReleaseConnectionState(s *ConnectionState) {
 		if s.Writer != nil {
 			e.writerPool.Put(s.Writer)
 		}
+		if s.TLS != nil {
+			s.TLS.release()
+		}
+		if s.Hijacked.Load() {
+			e.stats.activeHijacked.Add(-1)
+		}
 		s.Reset()
 		connectionStatePool.Put(s)
 	}
@@ -199,7 +400,8 @@ func (e *Engine) ServeConn(ctx context.Context, conn netpoll.Connection) error {
 	// Top-Level Panic Recovery for this connection
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("[Critical Panic] Recovered in ServeConn: %v\n%s", r, debug.Stack())
+			e.logConn(slog.LevelError, "panic recovered in ServeConn", conn, state,
+				slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
 			conn.Close()
 			// State will be released by the outer defer
 		}
@@ -209,20 +411,49 @@ func (e *Engine) ServeConn(ctx context.Context, conn netpoll.Connection) error {
 		return nil
 	}
 
+	// PROXY protocol: the header precedes everything else, including the TLS handshake.
+	if state.ProxyMode != proxyproto.Off && !e.readProxyHeader(conn, state) {
+		state.Processing.Store(false)
+		return nil
+	}
+
+	// TLS: decrypt what the reactor has buffered and serve the plaintext view.
+	if state.TLS != nil {
+		if err := state.TLS.Pump(); err != nil {
+			conn.Close()
+			state.Processing.Store(false)
+			return nil
+		}
+		conn = state.TLS
+	}
+
+	if state.counter.ReadWriter == nil {
+		state.counter = countingConn{ReadWriter: conn, stats: &e.stats}
+		if state.gate.installed() {
+			state.counter.gate = &state.gate
+		}
+	}
 	if state.Reader == nil {
 		state.Reader = e.readerPool.Get().(*bufio.Reader)
-		state.Reader.Reset(conn)
+		state.Reader.Reset(&state.counter)
 	}
 	if state.Writer == nil {
 		state.Writer = e.writerPool.Get().(*bufio.Writer)
-		state.Writer.Reset(conn)
+		state.Writer.Reset(&state.counter)
+	}
+
+	if state.h2.Load() != nil {
+		e.serveH2(conn, state)
+		return nil
 	}
 
 	if state.ReadHandler != nil {
 		func() {
 			defer func() {
 				if r := recover(); r != nil {
-					log.Printf("[Panic] Recovered in ReadHandler: %v\n%s", r, debug.Stack())
+					e.stats.handlerPanics.Add(1)
+					e.logConn(slog.LevelError, "panic recovered in read handler", conn, state,
+						slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
 					conn.Close()
 				}
 				state.Processing.Store(false)
@@ -230,7 +461,7 @@ func (e *Engine) ServeConn(ctx context.Context, conn netpoll.Connection) error {
 			rw := bufio.NewReadWriter(state.Reader, state.Writer)
 			if err := state.ReadHandler(conn, rw); err != nil {
 				if err != io.EOF && !strings.Contains(err.Error(), "EOF") {
-					log.Printf("ReadHandler error: %v", err)
+					e.logConn(slog.LevelWarn, "read handler error", conn, state, slog.Any("error", err))
 				}
 				conn.Close()
 			}
@@ -242,6 +473,32 @@ func (e *Engine) ServeConn(ctx context.Context, conn netpoll.Connection) error {
 	return nil
 }
 
+// readProxyHeader consumes a PROXY protocol header from the raw connection and
+// rewrites the connection addresses. It returns false if serving must stop for now
+// (the header is incomplete, or invalid and the connection was closed).
+func (e *Engine) readProxyHeader(conn netpoll.Connection, state *ConnectionState) bool {
+	r := conn.Reader()
+	buf, _ := r.Peek(min(r.Len(), proxyproto.MaxHeaderLen))
+	h, n, err := proxyproto.Parse(buf)
+	switch {
+	case err == proxyproto.ErrNoHeader && state.ProxyMode == proxyproto.Optional:
+	case err != nil:
+		conn.Close()
+		return false
+	case n == 0:
+		return false
+	default:
+		_ = r.Skip(n)
+		state.Proxy = h
+		if h.Source != nil {
+			state.RemoteAddr = h.Source.String()
+			state.LocalAddr = h.Destination
+		}
+	}
+	state.ProxyMode = proxyproto.Off
+	return true
+}
+
 var (
 	httpHeaderEnd              = []byte("\r\n\r\n")
 	httpHeaderLineSep          = []byte("\r\n")
@@ -249,9 +506,15 @@ var (
 	httpHeaderTransferEncoding = []byte("Transfer-Encoding:")
 )
 
-func shouldBypassFullRequestCheck(peekBuf []byte) bool {
+// shouldBypassFullRequestCheck reports whether peekBuf holds a complete bodiless request
+// within cfg's limits, so the full CheckRequest scan can be skipped.
+func shouldBypassFullRequestCheck(peekBuf []byte, cfg *parser.Config) bool {
+	// Strict mode validates every header line.
+	if cfg.Strict {
+		return false
+	}
 	headerEndIdx := bytes.Index(peekBuf, httpHeaderEnd)
-	if headerEndIdx == -1 || headerEndIdx > parser.MaxHeaderSize {
+	if headerEndIdx == -1 || headerEndIdx > cfg.HeaderSizeLimit() {
 		return false
 	}
 
@@ -261,7 +524,12 @@ func shouldBypassFullRequestCheck(peekBuf []byte) bool {
 		return false
 	}
 
+	count := 0
 	for cur := headers[idx+len(httpHeaderLineSep):]; len(cur) > 0; {
+		// Leave limit violations to CheckRequest so they are reported.
+		if count++; cfg.MaxHeaderCount > 0 && count > cfg.MaxHeaderCount {
+			return false
+		}
 		lineEnd := bytes.Index(cur, httpHeaderLineSep)
 		line := cur
 		if lineEnd >= 0 {
@@ -285,7 +553,8 @@ func shouldBypassFullRequestCheck(peekBuf []byte) bool {
 func (e *Engine) serveHTTP(ctx context.Context, conn netpoll.Connection, state *ConnectionState) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("[Panic] Recovered in serveHTTP: %v\n%s", r, debug.Stack())
+			e.logConn(slog.LevelError, "panic recovered in serveHTTP", conn, state,
+				slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
 			conn.Close()
 			state.Processing.Store(false)
 		}
@@ -297,6 +566,15 @@ func (e *Engine) serveHTTP(ctx context.Context, conn netpoll.Connection, state *
 			return
 		}
 
+		if state.RemoteAddr == "" {
+			if addr := conn.RemoteAddr(); addr != nil {
+				state.RemoteAddr = addr.String()
+			}
+		}
+		if state.LocalAddr == nil {
+			state.LocalAddr = conn.LocalAddr()
+		}
+
 		// Optimization: Check if we have enough data to parse a request
 		if state.Reader.Buffered() == 0 {
 			r := conn.Reader()
@@ -313,49 +591,101 @@ func (e *Engine) serveHTTP(ctx context.Context, conn netpoll.Connection, state *
 				}
 
 				peekBuf, _ := r.Peek(peekLen)
-				if !shouldBypassFullRequestCheck(peekBuf) {
-					check := parser.CheckRequest(peekBuf)
+				// HTTP/2 with prior knowledge opens the connection with its preface.
+				if e.h2c && state.served == 0 && state.TLS == nil {
+					if prefix, complete := isH2CPreface(peekBuf); complete {
+						e.startH2C(conn, state)
+						e.serveH2(conn, state)
+						return
+					} else if prefix {
+						e.armReadDeadline(conn, state, available, 0)
+						state.Processing.Store(false)
+						return
+					}
+				}
+				if !shouldBypassFullRequestCheck(peekBuf, &e.parser) {
+					// Framing resumes where the previous wake-up stopped.
+					check := e.parser.Resume(&state.framing, peekBuf)
 					if !check.Complete && check.Error == nil && peekLen < available {
 						peekBuf, _ = r.Peek(available)
-						check = parser.CheckRequest(peekBuf)
+						check = e.parser.Resume(&state.framing, peekBuf)
 					}
 					if check.Error != nil {
+						state.framing.Reset()
+						e.rejectRequest(conn, state, check.Error, peekBuf)
 						conn.Close()
 						state.Processing.Store(false)
 						return
 					}
-					if !check.Complete {
+					if check.ExpectContinue && !state.continued {
+						if e.immediateContinue {
+							state.sendContinue()
+						} else {
+							state.expect.Store(true)
+						}
+					}
+					// Dispatch as soon as the headers are in when streaming, or when the
+					// handler decides whether the client may send its body.
+					if !check.Complete && !(check.HeaderLength > 0 && (e.streamBody || state.expect.Load())) {
+						e.armReadDeadline(conn, state, available, check.HeaderLength)
 						state.Processing.Store(false)
 						return
 					}
 				}
+				state.bodyLimit = state.framing.BodyLimit()
+				state.framing.Reset()
+				e.clearReadDeadline(state)
 			}
-		}
-
-		if state.RemoteAddr == "" {
-			if addr := conn.RemoteAddr(); addr != nil {
-				state.RemoteAddr = addr.String()
-			}
+		} else if !e.checkPipelined(conn, state) {
+			state.Processing.Store(false)
+			return
 		}
 
 		requestContext := appcontext.NewRequestContext(conn, ctx, state.Reader, state.Writer)
 		requestContext.SetRemoteAddr(state.RemoteAddr)
+		requestContext.SetDraining(&state.Draining)
+		requestContext.SetExpectContinue(&state.expect)
+		requestContext.SetFlushDeferred(e.batchFlush)
 		requestContext.SetOnSetReadHandler(func(h appcontext.ReadHandler) {
 			state.ReadHandler = h
 		})
 
-		req, hijacked, err := e.handleRequest(requestContext)
+		if e.parseErrorHook != nil {
+			e.sampleRequest(conn, state)
+		}
+
+		e.ReportConnState(conn, state, http.StateActive)
+		expectContinue := state.expect.Load()
+		start := time.Now()
+		consumed := state.counter.read - uint64(state.Reader.Buffered())
+		req, hijacked, err := e.handleRequest(requestContext, conn, state)
 		requestContext.Release()
+		// The rest of a streamed body is drained below without holding the client back.
+		state.gate.close()
 
+		if err == errServedH2C {
+			// Frames the client sent behind the upgrade request are already buffered.
+			e.serveH2(conn, state)
+			return
+		}
 		if err != nil {
+			// Responses batched before this request still go out.
+			_ = state.Writer.Flush()
 			if err != io.EOF {
 				conn.Close()
 			}
 			state.Processing.Store(false)
 			return
 		}
+		if state.served++; state.served > 1 {
+			e.stats.keepAliveReuses.Add(1)
+		}
+		e.stats.requestDuration.observe(uint64(time.Since(start)))
 
 		if hijacked {
+			e.ReportConnState(conn, state, http.StateHijacked)
+			state.Hijacked.Store(true)
+			e.stats.activeHijacked.Add(1)
 			_ = conn.SetReadDeadline(time.Time{})
 			_ = conn.SetWriteDeadline(time.Time{})
 
@@ -368,32 +698,63 @@ func (e *Engine) serveHTTP(ctx context.Context, conn netpoll.Connection, state *
 			return
 		}
 
+		// A client refused before "100 Continue" never sent its body; nothing to drain.
+		declined := expectContinue && !state.continued
+		state.expect.Store(false)
+		state.continued = false
+
 		// Drain body for keep-alive
-		if req.Body != nil {
+		if req.Body != nil && !declined {
+			// Do not hold a batched response back while waiting for the body.
+			if e.batchFlush && req.Body != http.NoBody {
+				_ = state.Writer.Flush()
+			}
 			_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
 			n, _ := io.Copy(io.Discard, io.LimitReader(req.Body, e.maxDrainSize+1))
 			_ = req.Body.Close()
 			_ = conn.SetReadDeadline(time.Time{})
-			if n > e.maxDrainSize {
+			if n > e.maxDrainSize || state.body.exceeded {
 				req.Close = true
 			}
 		}
+		e.clearReadDeadline(state)
+		e.stats.requestSize.observe(state.counter.read - uint64(state.Reader.Buffered()) - consumed)
 
-		if req.Close || req.Header.Get("Connection") == "close" {
+		if req.Close || req.Header.Get("Connection") == "close" || state.Draining.Load() {
+			// Requests pipelined after this one are left unanswered.
+			_ = state.Writer.Flush()
 			conn.Close()
 			state.Processing.Store(false)
 			return
 		}
 
+		e.ReportConnState(conn, state, http.StateIdle)
+
 		// Restore KA Deadlines
 		_ = conn.SetReadDeadline(time.Time{})
 		if state.ReadTimeout > 0 {
 			_ = conn.SetReadTimeout(state.ReadTimeout)
 		}
 
-		if state.Reader.Buffered() > 0 {
+		// Serve requests the client has pipelined behind this one in order, up to the
+		// configured depth, before flushing their batched responses.
+		if requestPending(conn, state) {
+			if state.pipelined++; e.maxPipelineDepth > 0 && state.pipelined >= e.maxPipelineDepth {
+				_ = state.Writer.Flush()
+				conn.Close()
+				state.Processing.Store(false)
+				return
+			}
 			continue
 		}
+		state.pipelined = 0
+		if e.batchFlush {
+			if err := state.Writer.Flush(); err != nil {
+				conn.Close()
+				state.Processing.Store(false)
+				return
+			}
+		}
 
 		// Double-Check Locking
 		state.Processing.Store(false)
@@ -414,40 +775,39 @@ func (e *Engine) serveHTTP(ctx context.Context, conn netpoll.Connection, state *
 	}
 }
 
-func (e *Engine) handleRequest(ctx *appcontext.RequestContext) (*http.Request, bool, error) {
-	req, err := adaptor.GetRequest(ctx)
+func (e *Engine) handleRequest(ctx *appcontext.RequestContext, conn net.Conn, state *ConnectionState) (*http.Request, bool, error) {
+	req, err := adaptor.ParseRequest(ctx, &state.request)
 	if err != nil {
+		if err != io.EOF {
+			e.rejectRequest(conn, state, err, state.sample)
+		}
 		return nil, false, err
 	}
-
-	baseCtx := ctx.Req()
-	if e.requestTimeout > 0 {
-		timeoutCtx, cancel := context.WithTimeout(baseCtx, e.requestTimeout)
-		req = req.WithContext(timeoutCtx)
-		defer cancel()
-	} else {
-		req = req.WithContext(baseCtx)
+	if req.ProtoMajor != 1 {
+		err = errVersionNotSupported
+		e.rejectRequest(conn, state, err, state.sample)
+		return nil, false, err
+	}
+	if e.h2c && state.TLS == nil && isH2CUpgrade(req) {
+		e.upgradeH2C(ctx, state, req)
+		return nil, false, errServedH2C
+	}
+	admission, err := e.admit(ctx.Req(), req.URL.Path)
+	if err != nil {
+		if err != context.Canceled {
+			state.sendServiceUnavailable()
+		}
+		return nil, false, err
 	}
+	defer admission.release()
+	e.stats.requests.Add(1)
+	e.wrapBody(req, ctx.Conn(), state)
 
+	req = req.WithContext(ctx.Req())
 	respWriter := adaptor.NewResponseWriter(ctx, req)
 	defer respWriter.Release()
 
-	var panicked bool
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				panicked = true
-				log.Printf("[Panic] Recovered in handler: %v\n%s", r, debug.Stack())
-				if !respWriter.HeaderSent() {
-					respWriter.WriteHeader(http.StatusInternalServerError)
-					_ = respWriter.EndResponse()
-				}
-			}
-		}()
-		e.Handler.ServeHTTP(respWriter, req)
-	}()
-
-	if panicked {
+	if e.serveHandler(conn, state, respWriter, req) {
 		return nil, false, errors.New("handler panicked")
 	}
 
@@ -458,3 +818,37 @@ func (e *Engine) handleRequest(ctx *appcontext.RequestContext) (*http.Request, b
 
 	return req, respWriter.Hijacked(), nil
 }
+
+// handlerResponse is the part of a response writer serveHandler relies on, implemented
+// by the HTTP/1 writer and by HTTP/2 streams.
+type handlerResponse interface {
+	http.ResponseWriter
+	HeaderSent() bool
+	EndResponse() error
+}
+
+// serveHandler calls the Handler with the request timeout applied. A panic is logged and
+// counted, and answered with "500 Internal Server Error" if the response has not started.
+// It reports whether the handler panicked.
+func (e *Engine) serveHandler(conn net.Conn, state *ConnectionState, w handlerResponse, req *http.Request) (panicked bool) {
+	if e.requestTimeout > 0 {
+		timeoutCtx, cancel := context.WithTimeout(req.Context(), e.requestTimeout)
+		defer cancel()
+		req = req.WithContext(timeoutCtx)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			e.stats.handlerPanics.Add(1)
+			e.logConn(slog.LevelError, "panic recovered in handler", conn, state,
+				slog.Any("panic", r), slog.String("method", req.Method), slog.String("path", req.URL.Path),
+				slog.String("stack", string(debug.Stack())))
+			if !w.HeaderSent() {
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = w.EndResponse()
+			}
+		}
+	}()
+	e.Handler.ServeHTTP(w, req)
+	return false
+}
@@ -1,11 +1,19 @@
 package engine
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,6 +26,7 @@ type MockConnection struct {
 	netpoll.Connection
 	readBuf  bytes.Buffer
 	writeBuf bytes.Buffer
+	writes   int
 	closed   bool
 	reader   netpoll.Reader
 }
@@ -107,11 +116,22 @@ func (r *mockNetpollReader) Len() int {
 	return len(r.remaining())
 }
 
+// Read consumes the netpoll view when the test set one, as on a real connection,
+// so the engine sees what it has already read as gone from the reactor's buffer.
 func (m *MockConnection) Read(b []byte) (n int, err error) {
+	if r, ok := m.reader.(*mockNetpollReader); ok {
+		if r.Len() == 0 {
+			return 0, io.EOF
+		}
+		n = copy(b, r.remaining())
+		r.offset += n
+		return n, nil
+	}
 	return m.readBuf.Read(b)
 }
 
 func (m *MockConnection) Write(b []byte) (n int, err error) {
+	m.writes++
 	return m.writeBuf.Write(b)
 }
 
@@ -130,6 +150,9 @@ func (m *MockConnection) SetReadTimeout(t time.Duration) error { return nil }
 func (m *MockConnection) RemoteAddr() net.Addr {
 	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
 }
+func (m *MockConnection) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 80}
+}
 
 // Reader returns a valid reader so conn.Reader().Len() checks works in ServeConn double-check lock
 func (m *MockConnection) Reader() netpoll.Reader {
@@ -215,6 +238,37 @@ func TestEngine_ServeConn_PanicRecovery(t *testing.T) {
 	}
 }
 
+func TestEngine_LogsHandlerPanicWithFields(t *testing.T) {
+	var logBuf bytes.Buffer
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), WithLogger(slog.New(slog.NewJSONHandler(&logBuf, nil))))
+
+	conn := &MockConnection{}
+	conn.fillRequest("POST", "/panic", "")
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	_ = eng.ServeConn(state, conn)
+
+	var record map[string]any
+	line, _, _ := bytes.Cut(logBuf.Bytes(), []byte("\n"))
+	if err := json.Unmarshal(line, &record); err != nil {
+		t.Fatalf("Failed to decode log record %q: %v", logBuf.String(), err)
+	}
+	if record["msg"] != "panic recovered in handler" {
+		t.Errorf("Expected handler panic message, got %v", record["msg"])
+	}
+	if record["method"] != "POST" || record["path"] != "/panic" {
+		t.Errorf("Expected method/path POST /panic, got %v %v", record["method"], record["path"])
+	}
+	if record["conn_id"] != float64(state.ID) {
+		t.Errorf("Expected conn_id %d, got %v", state.ID, record["conn_id"])
+	}
+	if record["remote_addr"] != "127.0.0.1:8080" {
+		t.Errorf("Expected remote_addr 127.0.0.1:8080, got %v", record["remote_addr"])
+	}
+}
+
 func TestEngine_RequestContext_InheritsConnectionState(t *testing.T) {
 	var state *ConnectionState
 	inherited := make(chan bool, 1)
@@ -392,6 +446,37 @@ func TestEngine_ServeConn_ClosesOversizedHeader(t *testing.T) {
 	if called {
 		t.Fatal("handler should not be called when parser rejects the request")
 	}
+	if !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 431 ") {
+		t.Fatalf("expected 431 response, got %q", conn.writeBuf.String())
+	}
+}
+
+func TestEngine_MaxHeaderSizeAndCount(t *testing.T) {
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithMaxHeaderSize(32<<10), WithMaxHeaderCount(3))
+
+	serve := func(req string) (*MockConnection, string) {
+		conn := &MockConnection{}
+		conn.readBuf.WriteString(req)
+		conn.reader = newMockNetpollReader([]byte(req))
+		state := NewConnectionState(time.Second)
+		defer state.Cancel()
+		if err := eng.ServeConn(state, conn); err != nil {
+			t.Fatalf("ServeConn failed: %v", err)
+		}
+		return conn, conn.writeBuf.String()
+	}
+
+	bigCookie := "GET / HTTP/1.1\r\nHost: x\r\nCookie: " + strings.Repeat("c", 16<<10) + "\r\n\r\n"
+	if _, out := serve(bigCookie); !strings.HasPrefix(out, "HTTP/1.1 200 ") {
+		t.Fatalf("expected a 16KB cookie to be accepted with a 32KB limit, got %q", out)
+	}
+
+	tooMany := "GET / HTTP/1.1\r\nHost: x\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n"
+	conn, out := serve(tooMany)
+	if !strings.HasPrefix(out, "HTTP/1.1 431 ") || !conn.closed {
+		t.Fatalf("expected 431 and close for 4 headers with a limit of 3, got %q", out)
+	}
 }
 
 func TestEngine_ServeConn_WaitsForPartialRequest(t *testing.T) {
@@ -444,6 +529,11 @@ func TestShouldBypassFullRequestCheck(t *testing.T) {
 			data: []byte("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n"),
 			want: false,
 		},
+		{
+			name: "too many headers keep full check",
+			data: []byte("GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\n\r\n"),
+			want: false,
+		},
 		{
 			name: "incomplete headers keep full check",
 			data: []byte("GET / HTTP/1.1\r\nHost: localhost\r\nUser-Agent: hon-test"),
@@ -453,7 +543,7 @@ func TestShouldBypassFullRequestCheck(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := shouldBypassFullRequestCheck(tt.data); got != tt.want {
+			if got := shouldBypassFullRequestCheck(tt.data, &parser.Config{MaxHeaderCount: 2}); got != tt.want {
 				t.Fatalf("shouldBypassFullRequestCheck() = %v, want %v", got, tt.want)
 			}
 		})
@@ -461,3 +551,782 @@ func TestShouldBypassFullRequestCheck(t *testing.T) {
 }
 
 // Helper for string contains check
+
+func TestEngine_ServeConn_DrainingClosesConnection(t *testing.T) {
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("bye"))
+	}))
+
+	conn := &MockConnection{}
+	conn.fillRequest("GET", "/", "")
+
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	state.Draining.Store(true)
+
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+
+	output := conn.writeBuf.String()
+	if !strings.Contains(output, "Connection: close") {
+		t.Errorf("expected Connection: close while draining, got output:\n%s", output)
+	}
+	if !conn.closed {
+		t.Error("connection should be closed after the response while draining")
+	}
+}
+
+func TestEngine_Stats(t *testing.T) {
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	conn := &MockConnection{}
+	conn.readBuf.WriteString("GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	conn.readBuf.WriteString("GET /b HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	conn.readBuf.WriteString("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	in := int64(conn.readBuf.Len())
+
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+
+	bad := &MockConnection{}
+	bad.reader = newMockNetpollReader(bytes.Repeat([]byte("X"), parser.MaxHeaderSize+1))
+	badState := NewConnectionState(time.Second)
+	defer badState.Cancel()
+	if err := eng.ServeConn(badState, bad); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+
+	stats := eng.Stats()
+	if stats.Requests != 3 {
+		t.Errorf("Requests = %d, want 3", stats.Requests)
+	}
+	if stats.KeepAliveReuses != 1 {
+		t.Errorf("KeepAliveReuses = %d, want 1", stats.KeepAliveReuses)
+	}
+	if stats.HandlerPanics != 1 {
+		t.Errorf("HandlerPanics = %d, want 1", stats.HandlerPanics)
+	}
+	if stats.ParseErrors != 1 {
+		t.Errorf("ParseErrors = %d, want 1", stats.ParseErrors)
+	}
+	if stats.BytesRead != uint64(in) {
+		t.Errorf("BytesRead = %d, want %d", stats.BytesRead, in)
+	}
+	if want := conn.writeBuf.Len() + bad.writeBuf.Len(); stats.BytesWritten != uint64(want) {
+		t.Errorf("BytesWritten = %d, want %d", stats.BytesWritten, want)
+	}
+}
+
+func TestHistogram_Snapshot(t *testing.T) {
+	h := newHistogram([]float64{10, 100}, 1)
+	for _, v := range []uint64{1, 10, 50, 1000} {
+		h.observe(v)
+	}
+	s := h.snapshot()
+	if s.Count != 4 || s.Sum != 1061 {
+		t.Fatalf("unexpected count/sum: %+v", s)
+	}
+	if s.Counts[0] != 2 || s.Counts[1] != 3 {
+		t.Fatalf("expected cumulative counts [2 3], got %v", s.Counts)
+	}
+}
+
+func TestHistogram_SnapshotConcurrent(t *testing.T) {
+	h := newHistogram([]float64{10, 100}, 1)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					h.observe(5)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	for range 10000 {
+		s := h.snapshot()
+		if last := s.Counts[len(s.Counts)-1]; last > s.Count {
+			t.Fatalf("bucket count %d exceeds total %d", last, s.Count)
+		}
+	}
+}
+
+func TestHistogram_DurationBounds(t *testing.T) {
+	var stats engineStats
+	stats.init()
+	h := stats.requestDuration
+	h.observe(uint64(time.Second))
+	h.observe(uint64(250 * time.Millisecond))
+
+	s := h.snapshot()
+	if fmt.Sprint(s.Bounds) != fmt.Sprint(DurationBuckets) {
+		t.Fatalf("Bounds = %v, want %v", s.Bounds, DurationBuckets)
+	}
+	for i, bound := range s.Bounds {
+		want := uint64(0)
+		switch {
+		case bound >= 1:
+			want = 2
+		case bound >= 0.25:
+			want = 1
+		}
+		if s.Counts[i] != want {
+			t.Errorf("bucket le=%v has %d observations, want %d", bound, s.Counts[i], want)
+		}
+	}
+}
+
+func TestEngine_ConnState(t *testing.T) {
+	var states []http.ConnState
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), WithConnState(func(c net.Conn, s http.ConnState) {
+		states = append(states, s)
+	}))
+
+	conn := &MockConnection{}
+	conn.readBuf.WriteString("GET /1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	conn.readBuf.WriteString("GET /2 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+
+	eng.ReportConnState(conn, state, http.StateNew)
+	eng.ReportConnState(conn, state, http.StateNew) // Repeated: dropped.
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+	eng.ReportConnState(conn, state, http.StateClosed)
+
+	want := []http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateActive, http.StateIdle, http.StateClosed}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+}
+
+func TestEngine_ConnState_Hijacked(t *testing.T) {
+	var states []http.ConnState
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Hijacker).Hijack()
+	}), WithConnState(func(c net.Conn, s http.ConnState) {
+		states = append(states, s)
+	}))
+
+	conn := &MockConnection{}
+	conn.readBuf.WriteString("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	state := NewConnectionState(time.Second)
+	state.Cancel() // Let serveHTTP return after the hijack.
+
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+	eng.ReportConnState(conn, state, http.StateClosed)
+
+	want := []http.ConnState{http.StateActive, http.StateHijacked}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+}
+
+func TestEngine_ConnState_ConcurrentClose(t *testing.T) {
+	var mu sync.Mutex
+	var states []http.ConnState
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithConnState(func(c net.Conn, s http.ConnState) {
+			mu.Lock()
+			states = append(states, s)
+			mu.Unlock()
+		}))
+	conn := &MockConnection{}
+
+	for i := 0; i < 100; i++ {
+		states = nil
+		state := NewConnectionState(time.Second)
+		eng.ReportConnState(conn, state, http.StateActive)
+
+		// The serving goroutine finishes a request while the close callback runs.
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			eng.ReportConnState(conn, state, http.StateIdle)
+		}()
+		go func() {
+			defer wg.Done()
+			eng.ReportConnState(conn, state, http.StateClosed)
+		}()
+		wg.Wait()
+		state.Cancel()
+
+		if n := len(states); n < 2 || n > 3 || states[n-1] != http.StateClosed {
+			t.Fatalf("states = %v, want StateClosed reported once, last", states)
+		}
+	}
+}
+
+func TestEngine_MaxRequestBodySize(t *testing.T) {
+	called := false
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), WithMaxRequestBodySize(10))
+
+	for _, req := range []string{
+		// Only the headers have arrived: the declared length alone is enough to reject.
+		"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 11\r\n\r\n",
+		"POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n6\r\nworld!\r\n",
+	} {
+		conn := &MockConnection{}
+		conn.readBuf.WriteString(req)
+		conn.reader = newMockNetpollReader([]byte(req))
+		state := NewConnectionState(time.Second)
+		if err := eng.ServeConn(state, conn); err != nil {
+			t.Fatalf("ServeConn failed: %v", err)
+		}
+		state.Cancel()
+		if !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 413 ") || !conn.closed {
+			t.Errorf("expected 413 and close for %q, got %q", req, conn.writeBuf.String())
+		}
+	}
+	if called {
+		t.Fatal("handler should not be called for an oversized body")
+	}
+	if got := eng.Stats().ParseErrors; got != 0 {
+		t.Errorf("ParseErrors = %d, want 0", got)
+	}
+}
+
+func TestEngine_SetMaxRequestBodySize(t *testing.T) {
+	var readErr error
+	var got []byte
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !SetMaxRequestBodySize(r.Context(), 4) {
+			t.Error("SetMaxRequestBodySize reported no engine request")
+		}
+		got, readErr = io.ReadAll(r.Body)
+		var maxErr *http.MaxBytesError
+		if errors.As(readErr, &maxErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}), WithMaxRequestBodySize(1024))
+
+	req := "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\n0123456789"
+	conn := &MockConnection{}
+	conn.readBuf.WriteString(req)
+	conn.reader = newMockNetpollReader([]byte(req))
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+
+	if string(got) != "0123" {
+		t.Errorf("expected the first 4 bytes before the limit, got %q", got)
+	}
+	if !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 413 ") {
+		t.Errorf("expected handler's 413, got %q", conn.writeBuf.String())
+	}
+	if !conn.closed {
+		t.Error("expected the connection to close after an over-limit body")
+	}
+	if SetMaxRequestBodySize(context.Background(), 1) {
+		t.Error("SetMaxRequestBodySize should report false outside an engine request")
+	}
+}
+
+func TestEngine_PathMaxRequestBodySize(t *testing.T) {
+	var got []string
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, string(body))
+	}), WithMaxRequestBodySize(10), WithPathMaxRequestBodySize("/upload", 20))
+
+	tests := []struct {
+		req      string
+		want413  bool
+		wantBody string
+	}{
+		{"POST /upload/a?x=1 HTTP/1.1\r\nHost: x\r\nContent-Length: 15\r\n\r\n0123456789abcde", false, "0123456789abcde"},
+		{"POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 21\r\n\r\n", true, ""},
+		{"POST /other HTTP/1.1\r\nHost: x\r\nContent-Length: 15\r\n\r\n", true, ""},
+		{"POST /upload HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\nf\r\n0123456789abcde\r\n0\r\n\r\n", false, "0123456789abcde"},
+	}
+	for _, tt := range tests {
+		got = nil
+		conn := &MockConnection{}
+		conn.readBuf.WriteString(tt.req)
+		conn.reader = newMockNetpollReader([]byte(tt.req))
+		state := NewConnectionState(time.Second)
+		if err := eng.ServeConn(state, conn); err != nil {
+			t.Fatalf("ServeConn failed: %v", err)
+		}
+		state.Cancel()
+		if is413 := strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 413 "); is413 != tt.want413 {
+			t.Errorf("%q: got %q, want 413 = %v", tt.req, conn.writeBuf.String(), tt.want413)
+		}
+		if !tt.want413 && (len(got) != 1 || got[0] != tt.wantBody) {
+			t.Errorf("%q: handler read %q, want %q", tt.req, got, tt.wantBody)
+		}
+	}
+}
+
+func TestEngine_SetMaxRequestBodySize_NoBody(t *testing.T) {
+	var set []bool
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set = append(set, SetMaxRequestBodySize(r.Context(), 10))
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	// The body-less request follows one whose body was wrapped on the same connection.
+	req := "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\n\r\nabcGET / HTTP/1.1\r\nHost: x\r\n\r\n"
+	conn := &MockConnection{reader: newMockNetpollReader([]byte(req))}
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+	if len(set) != 2 || !set[0] || set[1] {
+		t.Fatalf("SetMaxRequestBodySize results = %v, want [true false]", set)
+	}
+	if strings.Count(conn.writeBuf.String(), "HTTP/1.1 200 ") != 2 || conn.closed {
+		t.Errorf("expected two responses on an open connection, got %q", conn.writeBuf.String())
+	}
+}
+
+func TestEngine_MalformedRequests(t *testing.T) {
+	type report struct {
+		err  error
+		data string
+	}
+	var reports []report
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("handler called for %s %s", r.Method, r.URL)
+	}), WithParseErrorHook(func(conn net.Conn, err error, data []byte) {
+		reports = append(reports, report{err, string(data)})
+	}))
+
+	tests := []struct {
+		name   string
+		req    string
+		status string
+	}{
+		{"garbage request line", "BADREQUEST\r\nHost: x\r\n\r\n", "400"},
+		{"invalid content length", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: abc\r\n\r\n", "400"},
+		{"invalid chunk size", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", "400"},
+		{"unsupported version", "GET / HTTP/2.0\r\nHost: x\r\n\r\n", "505"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports = nil
+			conn := &MockConnection{}
+			conn.readBuf.WriteString(tt.req)
+			conn.reader = newMockNetpollReader([]byte(tt.req))
+			state := NewConnectionState(time.Second)
+			defer state.Cancel()
+			if err := eng.ServeConn(state, conn); err != nil {
+				t.Fatalf("ServeConn failed: %v", err)
+			}
+
+			out := conn.writeBuf.String()
+			if !strings.HasPrefix(out, "HTTP/1.1 "+tt.status+" ") || !strings.Contains(out, "Connection: close") {
+				t.Errorf("expected %s with Connection: close, got %q", tt.status, out)
+			}
+			if !conn.closed {
+				t.Error("expected the connection to be closed")
+			}
+			if len(reports) != 1 || reports[0].err == nil || reports[0].data != tt.req {
+				t.Errorf("expected one hook report with the request bytes, got %+v", reports)
+			}
+		})
+	}
+}
+
+func TestEngine_RequestLineOnly(t *testing.T) {
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	req := "GET / HTTP/1.0\r\n\r\n"
+	conn := &MockConnection{}
+	conn.readBuf.WriteString(req)
+	conn.reader = newMockNetpollReader([]byte(req))
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+	if !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 200 ") {
+		t.Fatalf("expected 200 for a request without header fields, got %q", conn.writeBuf.String())
+	}
+}
+
+func TestEngine_StrictParsing(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	req := "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"
+	for _, strict := range []bool{false, true} {
+		conn := &MockConnection{}
+		conn.readBuf.WriteString(req)
+		conn.reader = newMockNetpollReader([]byte(req))
+		state := NewConnectionState(time.Second)
+		if err := NewEngine(handler, WithStrictParsing(strict)).ServeConn(state, conn); err != nil {
+			t.Fatalf("ServeConn failed: %v", err)
+		}
+		state.Cancel()
+
+		want := "HTTP/1.1 200 "
+		if strict {
+			want = "HTTP/1.1 400 "
+		}
+		if got := conn.writeBuf.String(); !strings.HasPrefix(got, want) {
+			t.Errorf("strict=%v: expected %q, got %q", strict, want, got)
+		}
+		if strict && !conn.closed {
+			t.Error("expected the connection to be closed")
+		}
+	}
+}
+
+func TestEngine_IncrementalFraming(t *testing.T) {
+	var got string
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	req := "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\nX-Sum: 1\r\n\r\n"
+
+	// The request trickles in a few bytes per wake-up.
+	conn := &MockConnection{}
+	reader := newMockNetpollReader(nil)
+	conn.reader = reader
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	for i := 0; i < len(req); i += 7 {
+		piece := req[i:min(i+7, len(req))]
+		reader.data = append(reader.data, piece...)
+		conn.readBuf.WriteString(piece)
+		if err := eng.ServeConn(state, conn); err != nil {
+			t.Fatalf("ServeConn failed: %v", err)
+		}
+		if i+7 < len(req) && conn.writeBuf.Len() > 0 {
+			t.Fatalf("responded before the request was complete (%d bytes): %q", i+7, conn.writeBuf.String())
+		}
+	}
+	if got != "hello world" || !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 200 ") {
+		t.Errorf("expected the body to be served once complete, got body %q, response %q", got, conn.writeBuf.String())
+	}
+}
+
+// readPipelinedResponses parses the responses written to conn, one per method, as
+// "status content-length:body".
+func readPipelinedResponses(t *testing.T, conn *MockConnection, methods ...string) []string {
+	t.Helper()
+	br := bufio.NewReader(bytes.NewReader(conn.writeBuf.Bytes()))
+	var bodies []string
+	for _, method := range methods {
+		resp, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			t.Fatalf("reading response %d: %v\n%s", len(bodies)+1, err, conn.writeBuf.String())
+		}
+		b, _ := io.ReadAll(resp.Body)
+		bodies = append(bodies, strconv.Itoa(resp.StatusCode)+" "+resp.Header.Get("Content-Length")+":"+string(b))
+	}
+	if br.Buffered() > 0 {
+		rest, _ := io.ReadAll(br)
+		t.Errorf("unexpected data after %d responses: %q", len(methods), rest)
+	}
+	return bodies
+}
+
+func TestEngine_Pipelining(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		io.WriteString(w, "Response "+r.URL.Query().Get("id"))
+	})
+	tests := []struct {
+		name       string
+		opts       []Option
+		requests   string
+		methods    []string
+		want       []string
+		wantClosed bool
+	}{
+		{
+			name:     "ordered with HEAD",
+			requests: "GET /?id=1 HTTP/1.1\r\n\r\nHEAD /?id=2 HTTP/1.1\r\n\r\nGET /?id=3 HTTP/1.1\r\n\r\n",
+			methods:  []string{"GET", "HEAD", "GET"},
+			want:     []string{"200 10:Response 1", "200 10:", "200 10:Response 3"},
+		},
+		{
+			name:       "close mid-pipeline",
+			requests:   "GET /?id=1 HTTP/1.1\r\n\r\nGET /?id=2 HTTP/1.1\r\nConnection: close\r\n\r\nGET /?id=3 HTTP/1.1\r\n\r\n",
+			methods:    []string{"GET", "GET"},
+			want:       []string{"200 10:Response 1", "200 10:Response 2"},
+			wantClosed: true,
+		},
+		{
+			name:       "depth exceeded",
+			opts:       []Option{WithMaxPipelineDepth(2)},
+			requests:   "GET /?id=1 HTTP/1.1\r\n\r\nGET /?id=2 HTTP/1.1\r\n\r\nGET /?id=3 HTTP/1.1\r\n\r\n",
+			methods:    []string{"GET", "GET"},
+			want:       []string{"200 10:Response 1", "200 10:Response 2"},
+			wantClosed: true,
+		},
+		{
+			name:     "depth reached",
+			opts:     []Option{WithMaxPipelineDepth(2)},
+			requests: "GET /?id=1 HTTP/1.1\r\n\r\nGET /?id=2 HTTP/1.1\r\n\r\n",
+			methods:  []string{"GET", "GET"},
+			want:     []string{"200 10:Response 1", "200 10:Response 2"},
+		},
+		{
+			name:       "header count limit",
+			opts:       []Option{WithMaxHeaderCount(2)},
+			requests:   "GET /?id=1 HTTP/1.1\r\n\r\nGET /?id=2 HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\nE: 5\r\n\r\n",
+			methods:    []string{"GET", "GET"},
+			want:       []string{"200 10:Response 1", "431 0:"},
+			wantClosed: true,
+		},
+		{
+			name:       "declared body too large",
+			opts:       []Option{WithMaxRequestBodySize(100)},
+			requests:   "GET /?id=1 HTTP/1.1\r\n\r\nPOST /?id=2 HTTP/1.1\r\nContent-Length: 1000\r\n\r\n",
+			methods:    []string{"GET", "POST"},
+			want:       []string{"200 10:Response 1", "413 0:"},
+			wantClosed: true,
+		},
+		{
+			name:       "strict framing",
+			opts:       []Option{WithStrictParsing(true)},
+			requests:   "GET /?id=1 HTTP/1.1\r\n\r\nPOST /?id=2 HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			methods:    []string{"GET", "POST"},
+			want:       []string{"200 10:Response 1", "400 0:"},
+			wantClosed: true,
+		},
+	}
+	for _, tt := range tests {
+		for _, batched := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/batched=%v", tt.name, batched), func(t *testing.T) {
+				eng := NewEngine(handler, append(tt.opts, WithBatchedFlush(batched))...)
+				conn := &MockConnection{reader: newMockNetpollReader([]byte(tt.requests))}
+				state := NewConnectionState(time.Second)
+				defer state.Cancel()
+				if err := eng.ServeConn(state, conn); err != nil {
+					t.Fatalf("ServeConn failed: %v", err)
+				}
+
+				got := readPipelinedResponses(t, conn, tt.methods...)
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("responses = %q, want %q", got, tt.want)
+				}
+				if conn.closed != tt.wantClosed {
+					t.Errorf("closed = %v, want %v", conn.closed, tt.wantClosed)
+				}
+				if batched && conn.writes != 1 {
+					t.Errorf("expected the responses in a single write, got %d", conn.writes)
+				}
+			})
+		}
+	}
+}
+
+func TestHandlerLimit_Queueing(t *testing.T) {
+	limit := NewHandlerLimit(1, 1, 50*time.Millisecond)
+	if err := limit.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	admitted := make(chan error, 1)
+	go func() { admitted <- limit.acquire(context.Background()) }()
+	for limit.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := limit.acquire(context.Background()); err != errLimitQueueFull {
+		t.Errorf("expected errLimitQueueFull with the queue full, got %v", err)
+	}
+	limit.release()
+	if err := <-admitted; err != nil {
+		t.Fatalf("queued acquire failed: %v", err)
+	}
+
+	// The slot is held again, so the next waiter times out.
+	if err := limit.acquire(context.Background()); err != errQueueTimeout {
+		t.Errorf("expected errQueueTimeout, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limit.acquire(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	limit.release()
+
+	want := HandlerLimitStats{Running: 0, Queued: 0, Rejected: 1, TimedOut: 1}
+	if got := limit.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestEngine_HandlerLimit(t *testing.T) {
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-unblock
+		}
+		io.WriteString(w, "ok")
+	})
+	slow := NewHandlerLimit(1, 0, 0)
+	eng := NewEngine(handler, WithHandlerLimit(NewHandlerLimit(4, 0, 0)), WithPathHandlerLimit("/slow", slow))
+
+	serve := func(path string) *MockConnection {
+		conn := &MockConnection{}
+		conn.readBuf.WriteString("GET " + path + " HTTP/1.1\r\nHost: x\r\n\r\n")
+		state := NewConnectionState(time.Second)
+		defer state.Cancel()
+		if err := eng.ServeConn(state, conn); err != nil {
+			t.Errorf("ServeConn failed: %v", err)
+		}
+		return conn
+	}
+
+	done := make(chan *MockConnection)
+	go func() { done <- serve("/slow") }()
+	<-entered
+
+	// The slow pool is saturated and has no queue, so it sheds load at once...
+	if conn := serve("/slow"); conn.writeBuf.String() != string(serviceUnavailableResponse) || !conn.closed {
+		t.Errorf("expected a 503 and a closed connection, got %q (closed %v)", conn.writeBuf.String(), conn.closed)
+	}
+	// ...while other paths keep being served.
+	if conn := serve("/fast"); !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 200 ") {
+		t.Errorf("expected /fast to be served, got %q", conn.writeBuf.String())
+	}
+
+	close(unblock)
+	if conn := <-done; !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 200 ") {
+		t.Errorf("expected /slow to be served, got %q", conn.writeBuf.String())
+	}
+	if got := slow.Stats(); got.Rejected != 1 || got.Running != 0 {
+		t.Errorf("unexpected pool stats %+v", got)
+	}
+}
+
+func TestAdaptiveLimiter_Algorithms(t *testing.T) {
+	t.Run("gradient", func(t *testing.T) {
+		l := NewAdaptiveLimiter(AdaptiveLimitConfig{InitialLimit: 20, MaxLimit: 100})
+		for i := 0; i < 50; i++ {
+			l.release(time.Millisecond, l.Stats().Limit)
+		}
+		grown := l.Stats().Limit
+		if grown <= 20 {
+			t.Fatalf("expected the limit to grow at steady latency, got %d", grown)
+		}
+		for i := 0; i < 20; i++ {
+			l.release(10*time.Millisecond, l.Stats().Limit)
+		}
+		if got := l.Stats().Limit; got >= grown {
+			t.Errorf("expected the limit to shrink as latency rose, got %d (was %d)", got, grown)
+		}
+		// An underused limit is left alone.
+		before := l.Stats().Limit
+		l.release(time.Millisecond, 1)
+		if got := l.Stats().Limit; got != before {
+			t.Errorf("expected the limit to stay at %d while mostly idle, got %d", before, got)
+		}
+	})
+
+	t.Run("aimd", func(t *testing.T) {
+		l := NewAdaptiveLimiter(AdaptiveLimitConfig{Algorithm: LimitAIMD, InitialLimit: 10, LatencyThreshold: 5 * time.Millisecond})
+		l.release(time.Millisecond, 10)
+		if got := l.Stats().Limit; got != 11 {
+			t.Errorf("expected an additive increase to 11, got %d", got)
+		}
+		l.release(10*time.Millisecond, 11)
+		if got := l.Stats().Limit; got != 9 {
+			t.Errorf("expected a multiplicative decrease to 9, got %d", got)
+		}
+	})
+}
+
+func TestEngine_AdaptiveLimit(t *testing.T) {
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			entered <- struct{}{}
+			<-unblock
+		}
+	})
+	limiter := NewAdaptiveLimiter(AdaptiveLimitConfig{InitialLimit: 1, MaxLimit: 1})
+	eng := NewEngine(handler, WithAdaptiveLimit(limiter))
+
+	serve := func(path string) *MockConnection {
+		conn := &MockConnection{}
+		conn.readBuf.WriteString("GET " + path + " HTTP/1.1\r\nHost: x\r\n\r\n")
+		state := NewConnectionState(time.Second)
+		defer state.Cancel()
+		if err := eng.ServeConn(state, conn); err != nil {
+			t.Errorf("ServeConn failed: %v", err)
+		}
+		return conn
+	}
+
+	done := make(chan *MockConnection)
+	go func() { done <- serve("/block") }()
+	<-entered
+	if conn := serve("/"); conn.writeBuf.String() != string(serviceUnavailableResponse) || !conn.closed {
+		t.Errorf("expected a 503 over the limit, got %q (closed %v)", conn.writeBuf.String(), conn.closed)
+	}
+	close(unblock)
+	if conn := <-done; !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 200 ") {
+		t.Errorf("expected the admitted request to be served, got %q", conn.writeBuf.String())
+	}
+	if conn := serve("/"); !strings.HasPrefix(conn.writeBuf.String(), "HTTP/1.1 200 ") {
+		t.Errorf("expected a request under the limit to be served, got %q", conn.writeBuf.String())
+	}
+
+	stats := eng.Stats()
+	if stats.ConcurrencyLimit != 1 || stats.LimitRejections != 1 {
+		t.Errorf("expected limit 1 and 1 rejection, got %d and %d", stats.ConcurrencyLimit, stats.LimitRejections)
+	}
+	if got := limiter.Stats().InFlight; got != 0 {
+		t.Errorf("expected no requests in flight, got %d", got)
+	}
+}
+
+func TestEngine_H2CUpgradeWithBodyStaysHTTP1(t *testing.T) {
+	eng := NewEngine(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Proto+" "+string(b))
+	}), WithH2C(true))
+	conn := &MockConnection{}
+	conn.readBuf.WriteString("POST / HTTP/1.1\r\nHost: x\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\n" +
+		"HTTP2-Settings: AAMAAABkAAQAAP__\r\nContent-Length: 5\r\n\r\nhello")
+	state := NewConnectionState(time.Second)
+	defer state.Cancel()
+	if err := eng.ServeConn(state, conn); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+	if got := conn.writeBuf.String(); !strings.HasPrefix(got, "HTTP/1.1 200 ") || !strings.Contains(got, "\r\nHTTP/1.1 hello\r\n") {
+		t.Errorf("expected the upgrade to be ignored, got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"errors"
+	"net"
+
+	"github.com/DevNewbie1826/hon/pkg/engine/parser"
+	"github.com/cloudwego/netpoll"
+)
+
+// Responses written before closing a connection whose request is rejected
+// before it reaches the handler.
+var (
+	badRequestResponse          = []byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+	headerTooLargeResponse      = []byte("HTTP/1.1 431 Request Header Fields Too Large\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+	versionNotSupportedResponse = []byte("HTTP/1.1 505 HTTP Version Not Supported\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+)
+
+// errVersionNotSupported is reported for requests with a major version other than 1.
+var errVersionNotSupported = errors.New("engine: unsupported HTTP version")
+
+// parseErrorSampleSize bounds how much of a request is kept for the parse error hook
+// when the error is found by adaptor.ParseRequest rather than the reactor's framing check.
+const parseErrorSampleSize = 1024
+
+// WithParseErrorHook registers a function called when a request is rejected as
+// malformed, with the error and the offending bytes (the buffered start of the request).
+// data is only valid during the call. The hook runs on the serving goroutine and
+// must not block.
+// WithParseErrorHook는 잘못된 요청이 거부될 때 오류와 문제의 바이트와 함께 호출되는 함수를 등록합니다.
+func WithParseErrorHook(fn func(conn net.Conn, err error, data []byte)) Option {
+	return func(e *Engine) {
+		e.parseErrorHook = fn
+	}
+}
+
+// errorResponse returns the response for a request rejected with err.
+func errorResponse(err error) []byte {
+	switch err {
+	case parser.ErrHeaderTooLarge, parser.ErrTooManyHeaders:
+		return headerTooLargeResponse
+	case parser.ErrBodyTooLarge:
+		return bodyTooLargeResponse
+	case errVersionNotSupported:
+		return versionNotSupportedResponse
+	}
+	return badRequestResponse
+}
+
+// rejectRequest answers a request that cannot be served with an error status.
+// The caller closes the connection.
+func (e *Engine) rejectRequest(conn net.Conn, state *ConnectionState, err error, data []byte) {
+	if err != parser.ErrBodyTooLarge {
+		e.stats.parseErrors.Add(1)
+		if e.parseErrorHook != nil {
+			e.parseErrorHook(conn, err, data)
+		}
+	}
+	_, _ = state.Writer.Write(errorResponse(err))
+	_ = state.Writer.Flush()
+}
+
+// sampleRequest copies the start of the next request so the parse error hook can
+// report it if adaptor.ParseRequest rejects the request.
+func (e *Engine) sampleRequest(conn netpoll.Connection, state *ConnectionState) {
+	var buf []byte
+	if n := state.Reader.Buffered(); n > 0 {
+		buf, _ = state.Reader.Peek(min(n, parseErrorSampleSize))
+	} else if r := conn.Reader(); r != nil {
+		buf, _ = r.Peek(min(r.Len(), parseErrorSampleSize))
+	}
+	state.sample = append(state.sample[:0], buf...)
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+
+	"github.com/DevNewbie1826/hon/pkg/appcontext"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+)
+
+// switchingToH2CResponse accepts an "Upgrade: h2c" request.
+var switchingToH2CResponse = []byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+
+// errServedH2C ends HTTP/1 processing of a connection that was upgraded to HTTP/2.
+var errServedH2C = errors.New("connection served as h2c")
+
+// WithH2C makes the engine speak HTTP/2 over cleartext TCP, to clients that open the
+// connection with the HTTP/2 preface (prior knowledge) and to HTTP/1.1 requests carrying
+// "Upgrade: h2c" without a body; upgrade requests with a body are answered over HTTP/1.1.
+// HTTP/2 connections stay on the reactor: frames are decoded as they arrive and each
+// stream runs the Handler on its own goroutine, so an idle connection holds none.
+// Streams go through WithAdaptiveLimit, the handler limits and the request timeout like
+// HTTP/1 requests, and count towards Stats. Request bodies are buffered up to the flow
+// control window (1MB per connection) until the handler reads them. Framing and HPACK
+// come from golang.org/x/net/http2. TLS connections keep HTTP/1.1.
+// WithH2C는 평문 TCP에서 HTTP/2(h2c)를 지원합니다(사전 지식 및 "Upgrade: h2c" 방식).
+// HTTP/2 연결도 리액터에서 처리되며, 스트림마다 핸들러 고루틴이 실행됩니다.
+func WithH2C(enabled bool) Option {
+	return func(e *Engine) {
+		e.h2c = enabled
+	}
+}
+
+// GoAway asks the HTTP/2 connection served with state to finish its active streams and
+// close, by sending GOAWAY. The returned channel is closed once the connection is closed;
+// it is nil if the connection does not speak HTTP/2. Servers call it for each of their
+// connections when shutting down, since netpoll sees no request in flight on an HTTP/2
+// connection whose streams are running.
+// GoAway는 state의 HTTP/2 연결에 GOAWAY를 보내 진행 중인 스트림을 마치고 닫도록 요청합니다.
+func (e *Engine) GoAway(state *ConnectionState) <-chan struct{} {
+	h := state.h2.Load()
+	if h == nil {
+		return nil
+	}
+	h.goAway()
+	return h.done
+}
+
+// isH2CPreface reports whether b starts like the HTTP/2 connection preface, and
+// whether it holds all of it.
+func isH2CPreface(b []byte) (prefix, complete bool) {
+	n := min(len(b), len(http2.ClientPreface))
+	prefix = string(b[:n]) == http2.ClientPreface[:n]
+	return prefix, prefix && n == len(http2.ClientPreface)
+}
+
+// isH2CUpgrade reports whether req asks to switch to h2c in a way the engine accepts.
+func isH2CUpgrade(req *http.Request) bool {
+	return req.Method != http.MethodConnect &&
+		(req.Body == nil || req.Body == http.NoBody) &&
+		httpguts.HeaderValuesContainsToken(req.Header["Upgrade"], "h2c") &&
+		httpguts.HeaderValuesContainsToken(req.Header["Connection"], "HTTP2-Settings") &&
+		len(req.Header["Http2-Settings"]) == 1
+}
+
+// parseH2CSettings decodes the HTTP2-Settings header of an upgrade request.
+func parseH2CSettings(v string) ([]http2.Setting, error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%6 != 0 {
+		return nil, http2.ConnectionError(http2.ErrCodeFrameSize)
+	}
+	settings := make([]http2.Setting, 0, len(b)/6)
+	for ; len(b) > 0; b = b[6:] {
+		s := http2.Setting{ID: http2.SettingID(binary.BigEndian.Uint16(b)), Val: binary.BigEndian.Uint32(b[2:])}
+		if err := s.Valid(); err != nil {
+			return nil, err
+		}
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+// upgradeH2C switches the connection serving req to HTTP/2, with req as stream 1.
+// A malformed HTTP2-Settings header gets "400 Bad Request".
+func (e *Engine) upgradeH2C(ctx *appcontext.RequestContext, state *ConnectionState, req *http.Request) {
+	conn := ctx.Conn()
+	settings, err := parseH2CSettings(req.Header.Get("Http2-Settings"))
+	if err != nil {
+		_, _ = state.Writer.Write(badRequestResponse)
+		_ = state.Writer.Flush()
+		conn.Close()
+		return
+	}
+	_, _ = state.Writer.Write(switchingToH2CResponse)
+	if err := state.Writer.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	h := e.startH2C(conn, state)
+	for _, s := range settings {
+		// Valid settings cannot overflow a window before any stream but this one exists.
+		_ = h.applySetting(s)
+	}
+	// Stream 1 is the first, so its ID cannot be refused.
+	s, _ := h.openStream(1, true)
+	if s == nil {
+		return
+	}
+	// The request storage is reused by the connection, so stream 1 gets a copy,
+	// presented as the HTTP/2 request it now is.
+	upgrade := req.Clone(s.ctx)
+	upgrade.Proto, upgrade.ProtoMajor, upgrade.ProtoMinor = "HTTP/2.0", 2, 0
+	upgrade.Body = http.NoBody
+	for _, h := range []string{"Connection", "Upgrade", "Http2-Settings"} {
+		upgrade.Header.Del(h)
+	}
+	h.dispatch(s, upgrade)
+}
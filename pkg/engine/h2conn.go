@@ -0,0 +1,692 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/cloudwego/netpoll"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// HTTP/2 limits advertised to clients.
+const (
+	h2MaxStreams    = 250      // SETTINGS_MAX_CONCURRENT_STREAMS; handlers still running count.
+	h2StreamWindow  = 1 << 20  // Body bytes a client may send on a stream ahead of the handler.
+	h2ConnWindow    = 1 << 20  // The same, across all streams of a connection.
+	h2MaxFrameSize  = 16 << 10 // Largest frame accepted, the protocol default.
+	h2DefaultWindow = 65535    // Flow control window before SETTINGS and WINDOW_UPDATE (RFC 9113 §6.9.2).
+	h2MaxWindow     = 1<<31 - 1
+)
+
+// h2StreamKey is the context key under which a stream's context holds the stream.
+type h2StreamKey struct{}
+
+// errH2StreamClosed fails body reads and response writes on a stream that was reset
+// or whose connection closed.
+var errH2StreamClosed = errors.New("engine: HTTP/2 stream closed")
+
+// h2Conn is the HTTP/2 session of a connection. The reactor feeds it what the client has
+// sent on each wake-up; it decodes whole frames only and starts a goroutine per request,
+// so nothing waits on the connection between frames.
+type h2Conn struct {
+	e     *Engine
+	conn  netpoll.Connection
+	state *ConnectionState
+	done  chan struct{} // Closed once the connection is closed.
+
+	// Input, only touched by the goroutine processing the connection.
+	in      []byte
+	rd      bytes.Reader // The whole frames of in, for the Framer.
+	preface bool         // The client preface has been consumed.
+	settled bool         // The client's first SETTINGS frame has arrived.
+
+	// Output, guarded by wmu. The Framer reads on the processing goroutine and
+	// writes under wmu, which it supports.
+	wmu      sync.Mutex
+	fr       *http2.Framer
+	enc      *hpack.Encoder
+	hbuf     bytes.Buffer
+	batching bool // The processing goroutine flushes once it is done with the input.
+
+	// Session state, guarded by mu. cond is broadcast whenever a window opens, body
+	// data arrives or streams are reset, for the handlers waiting on them.
+	mu            sync.Mutex
+	cond          sync.Cond
+	streams       map[uint32]*h2Stream
+	maxStreamID   uint32 // Highest stream the client has opened.
+	opened        int    // Streams opened, for keep-alive reuse stats.
+	sendWindow    int64  // DATA the client accepts on the connection.
+	initialWindow int64  // The client's SETTINGS_INITIAL_WINDOW_SIZE.
+	maxFrame      int    // The client's SETTINGS_MAX_FRAME_SIZE.
+	recvWindow    int64  // DATA the client may still send on the connection.
+	recvPending   int64  // Bytes consumed but not yet returned with WINDOW_UPDATE.
+	goingAway     bool   // GOAWAY sent; no new streams are served.
+	closed        bool
+}
+
+// startH2C switches the connection to HTTP/2 and sends the server's connection preface.
+func (e *Engine) startH2C(conn netpoll.Connection, state *ConnectionState) *h2Conn {
+	h := &h2Conn{
+		e:             e,
+		conn:          conn,
+		state:         state,
+		done:          make(chan struct{}),
+		streams:       make(map[uint32]*h2Stream),
+		sendWindow:    h2DefaultWindow,
+		initialWindow: h2DefaultWindow,
+		maxFrame:      h2MaxFrameSize,
+		recvWindow:    h2ConnWindow,
+	}
+	h.cond.L = &h.mu
+	h.fr = http2.NewFramer(state.Writer, &h.rd)
+	h.fr.SetMaxReadFrameSize(h2MaxFrameSize)
+	h.fr.MaxHeaderListSize = uint32(e.parser.HeaderSizeLimit())
+	h.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	h.enc = hpack.NewEncoder(&h.hbuf)
+	e.clearReadDeadline(state)
+
+	_ = h.write(func(fr *http2.Framer) error {
+		if err := fr.WriteSettings(
+			http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: h2MaxStreams},
+			http2.Setting{ID: http2.SettingInitialWindowSize, Val: h2StreamWindow},
+			http2.Setting{ID: http2.SettingMaxHeaderListSize, Val: uint32(e.parser.HeaderSizeLimit())},
+		); err != nil {
+			return err
+		}
+		return fr.WriteWindowUpdate(0, h2ConnWindow-h2DefaultWindow)
+	})
+	state.h2.Store(h)
+	// The connection may have closed before it was published for Cancel to find.
+	if state.Err() != nil {
+		h.abort()
+	}
+	return h
+}
+
+// serveH2 processes what the client has sent on an HTTP/2 connection.
+func (e *Engine) serveH2(conn netpoll.Connection, state *ConnectionState) {
+	h := state.h2.Load()
+	for {
+		if err := h.process(); err != nil {
+			h.fail(err)
+		}
+		state.Processing.Store(false)
+		if r := conn.Reader(); !conn.IsActive() || r.Len() == 0 || !state.Processing.CompareAndSwap(false, true) {
+			return
+		}
+	}
+}
+
+// process decodes and handles every whole frame received so far. Connection-level
+// protocol errors are returned; stream-level ones reset the stream.
+func (h *h2Conn) process() error {
+	h.read()
+	h.wmu.Lock()
+	h.batching = true
+	h.wmu.Unlock()
+	defer func() {
+		h.wmu.Lock()
+		h.batching = false
+		_ = h.state.Writer.Flush()
+		h.wmu.Unlock()
+	}()
+
+	if h.state.Draining.Load() {
+		h.goAway()
+	}
+	if !h.preface {
+		prefix, complete := isH2CPreface(h.in)
+		if !prefix {
+			return http2.ConnectionError(http2.ErrCodeProtocol)
+		}
+		if !complete {
+			return nil
+		}
+		h.consume(len(http2.ClientPreface))
+		h.preface = true
+	}
+
+	n, err := framedLen(h.in, 2*h.e.parser.HeaderSizeLimit()+h2MaxFrameSize)
+	if err != nil {
+		return err
+	}
+	h.rd.Reset(h.in[:n])
+	for h.rd.Len() > 0 {
+		f, err := h.fr.ReadFrame()
+		if err != nil {
+			var se http2.StreamError
+			if errors.As(err, &se) {
+				h.resetStream(se.StreamID, se.Code)
+				continue
+			}
+			if err == http2.ErrFrameTooLarge {
+				return http2.ConnectionError(http2.ErrCodeFrameSize)
+			}
+			return err
+		}
+		if err := h.handleFrame(f); err != nil {
+			return err
+		}
+	}
+	h.consume(n)
+	return nil
+}
+
+// read moves the bytes the client has sent into the input buffer, starting with any the
+// HTTP/1 reader had buffered before the connection switched protocols.
+func (h *h2Conn) read() {
+	if n := h.state.Reader.Buffered(); n > 0 {
+		b, _ := h.state.Reader.Peek(n)
+		h.in = append(h.in, b...)
+		_, _ = h.state.Reader.Discard(n)
+	}
+	r := h.conn.Reader()
+	if n := r.Len(); n > 0 {
+		b, _ := r.Next(n)
+		h.in = append(h.in, b...)
+		_ = r.Release()
+		h.e.stats.bytesRead.Add(uint64(n))
+	}
+}
+
+// consume drops the first n bytes of the input, letting go of a buffer grown by a burst
+// once it is empty.
+func (h *h2Conn) consume(n int) {
+	h.in = h.in[:copy(h.in, h.in[n:])]
+	if len(h.in) == 0 && cap(h.in) > 64<<10 {
+		h.in = nil
+	}
+}
+
+// framedLen returns how many bytes at the start of b form whole frames, keeping a header
+// block together with its CONTINUATION frames so the Framer decodes it in one go.
+// Unfinished header blocks larger than maxBlock are refused.
+func framedLen(b []byte, maxBlock int) (int, error) {
+	complete, block := 0, -1
+	for off := 0; len(b)-off >= 9; {
+		length := int(b[off])<<16 | int(b[off+1])<<8 | int(b[off+2])
+		if length > h2MaxFrameSize {
+			return 0, http2.ConnectionError(http2.ErrCodeFrameSize)
+		}
+		end := off + 9 + length
+		if end > len(b) {
+			break
+		}
+		typ, flags := http2.FrameType(b[off+3]), http2.Flags(b[off+4])
+		switch {
+		case block < 0 && (typ == http2.FrameHeaders || typ == http2.FramePushPromise):
+			if !flags.Has(http2.FlagHeadersEndHeaders) {
+				block = off
+			}
+		case block >= 0 && (typ != http2.FrameContinuation || flags.Has(http2.FlagContinuationEndHeaders)):
+			// Out-of-order frames end the block too, for the Framer to reject.
+			block = -1
+		}
+		off = end
+		if block < 0 {
+			complete = off
+		}
+	}
+	if block >= 0 && len(b)-block > maxBlock {
+		return 0, http2.ConnectionError(http2.ErrCodeEnhanceYourCalm)
+	}
+	return complete, nil
+}
+
+func (h *h2Conn) handleFrame(f http2.Frame) error {
+	if !h.settled {
+		if sf, ok := f.(*http2.SettingsFrame); !ok || sf.IsAck() {
+			return http2.ConnectionError(http2.ErrCodeProtocol)
+		}
+		h.settled = true
+	}
+	switch f := f.(type) {
+	case *http2.SettingsFrame:
+		return h.handleSettings(f)
+	case *http2.MetaHeadersFrame:
+		return h.handleHeaders(f)
+	case *http2.DataFrame:
+		return h.handleData(f)
+	case *http2.WindowUpdateFrame:
+		return h.handleWindowUpdate(f)
+	case *http2.RSTStreamFrame:
+		return h.handleReset(f)
+	case *http2.PingFrame:
+		if !f.IsAck() {
+			return h.write(func(fr *http2.Framer) error { return fr.WritePing(true, f.Data) })
+		}
+	case *http2.GoAwayFrame:
+		// The client opens no more streams; close once the current ones are done.
+		h.goAway()
+	case *http2.PushPromiseFrame:
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+	return nil
+}
+
+func (h *h2Conn) handleSettings(f *http2.SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	if err := f.ForeachSetting(func(s http2.Setting) error {
+		if err := s.Valid(); err != nil {
+			return err
+		}
+		return h.applySetting(s)
+	}); err != nil {
+		return err
+	}
+	return h.write(func(fr *http2.Framer) error { return fr.WriteSettingsAck() })
+}
+
+// applySetting adopts one of the client's settings.
+func (h *h2Conn) applySetting(s http2.Setting) error {
+	switch s.ID {
+	case http2.SettingInitialWindowSize:
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delta := int64(s.Val) - h.initialWindow
+		h.initialWindow = int64(s.Val)
+		for _, st := range h.streams {
+			if st.sendWindow += delta; st.sendWindow > h2MaxWindow {
+				return http2.ConnectionError(http2.ErrCodeFlowControl)
+			}
+		}
+		h.cond.Broadcast()
+	case http2.SettingMaxFrameSize:
+		h.mu.Lock()
+		h.maxFrame = int(s.Val)
+		h.mu.Unlock()
+	case http2.SettingHeaderTableSize:
+		h.wmu.Lock()
+		h.enc.SetMaxDynamicTableSizeLimit(s.Val)
+		h.wmu.Unlock()
+	}
+	return nil
+}
+
+func (h *h2Conn) handleHeaders(f *http2.MetaHeadersFrame) error {
+	id := f.StreamID
+	if id%2 == 0 {
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+	h.mu.Lock()
+	s, known := h.streams[id], id <= h.maxStreamID
+	h.mu.Unlock()
+	if s != nil {
+		h.handleTrailers(s, f)
+		return nil
+	}
+	if known {
+		// Trailers in flight on a stream closed by the server are dropped; anything else
+		// reuses a stream ID, which the client must always increase (RFC 9113 §5.1.1).
+		if f.StreamEnded() && len(f.PseudoFields()) == 0 {
+			return nil
+		}
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+
+	s, err := h.openStream(id, f.StreamEnded())
+	if s == nil {
+		return err
+	}
+	s.size = int64(f.Length)
+	req, status, err := h.newRequest(s, f)
+	switch {
+	case err != nil:
+		h.resetStream(id, http2.ErrCodeProtocol)
+		h.closeStream(s)
+	case status != 0:
+		// Rejected before the handler runs, like the reactor rejects HTTP/1 requests.
+		w := &h2Response{s: s, req: req}
+		w.WriteHeader(status)
+		_ = w.EndResponse()
+		h.closeStream(s)
+	default:
+		h.dispatch(s, req)
+	}
+	return nil
+}
+
+// openStream registers stream id, opened by the client. It returns nil for a stream
+// refused because the connection is going away or has too many streams, and a
+// connection error for an ID that does not increase.
+func (h *h2Conn) openStream(id uint32, ended bool) (*h2Stream, error) {
+	h.mu.Lock()
+	if id <= h.maxStreamID {
+		h.mu.Unlock()
+		return nil, http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+	h.maxStreamID = id
+	if h.goingAway || h.closed {
+		// Streams after the last one announced in GOAWAY are ignored (RFC 9113 §6.8).
+		h.mu.Unlock()
+		return nil, nil
+	}
+	if len(h.streams) >= h2MaxStreams {
+		h.mu.Unlock()
+		h.resetStream(id, http2.ErrCodeRefusedStream)
+		return nil, nil
+	}
+	s := &h2Stream{
+		h:          h,
+		id:         id,
+		endStream:  ended,
+		declared:   -1,
+		sendWindow: h.initialWindow,
+		recvWindow: h2StreamWindow,
+	}
+	if ended {
+		s.bodyErr = io.EOF
+	}
+	// The stream rides on the connection's context without its cancellation, and
+	// carries itself for SetMaxRequestBodySize.
+	s.ctx, s.cancel = context.WithCancel(context.WithValue(context.WithoutCancel(h.state), h2StreamKey{}, s))
+	h.streams[id] = s
+	if h.opened++; h.opened > 1 {
+		h.e.stats.keepAliveReuses.Add(1)
+	}
+	if len(h.streams) == 1 {
+		h.e.ReportConnState(h.conn, h.state, http.StateActive)
+	}
+	h.mu.Unlock()
+	return s, nil
+}
+
+// dispatch runs the handler for a stream's request on its own goroutine.
+func (h *h2Conn) dispatch(s *h2Stream, req *http.Request) {
+	h.e.AcquireConnectionState(h.state)
+	go h.e.serveH2Stream(h, s, req)
+}
+
+func (h *h2Conn) handleData(f *http2.DataFrame) error {
+	size, data := int64(f.Length), f.Data()
+	h.mu.Lock()
+	if size > h.recvWindow {
+		h.mu.Unlock()
+		return http2.ConnectionError(http2.ErrCodeFlowControl)
+	}
+	h.recvWindow -= size
+	s := h.streams[f.StreamID]
+	if s == nil || s.reset || s.endStream {
+		// Data for a stream that is gone still counts against the connection window.
+		idle := f.StreamID > h.maxStreamID
+		halfClosed := s != nil && !s.reset
+		_, connInc := h.credit(nil, size)
+		h.mu.Unlock()
+		h.writeWindowUpdates(0, 0, connInc)
+		switch {
+		case idle:
+			return http2.ConnectionError(http2.ErrCodeProtocol)
+		case halfClosed:
+			h.resetStream(f.StreamID, http2.ErrCodeStreamClosed)
+		}
+		return nil
+	}
+	if size > s.recvWindow {
+		h.mu.Unlock()
+		h.resetStream(s.id, http2.ErrCodeFlowControl)
+		return nil
+	}
+	s.recvWindow -= size
+	s.size += size
+	s.received += int64(len(data))
+	code, kept := http2.ErrCodeNo, 0
+	switch {
+	case s.declared >= 0 && s.received > s.declared,
+		f.StreamEnded() && s.declared >= 0 && s.received != s.declared:
+		code = http2.ErrCodeProtocol
+	case s.bodyErr != nil:
+		// Past the size limit: the handler already has all it may read.
+	default:
+		kept = len(data)
+		s.body.Write(data)
+	}
+	if f.StreamEnded() {
+		s.endStream = true
+		if s.bodyErr == nil {
+			s.bodyErr = io.EOF
+		}
+	}
+	// Padding and dropped data never reach the handler, so their window returns now.
+	streamInc, connInc := h.credit(s, size-int64(kept))
+	h.cond.Broadcast()
+	h.mu.Unlock()
+	if code != http2.ErrCodeNo {
+		h.resetStream(s.id, code)
+		return nil
+	}
+	h.writeWindowUpdates(s.id, streamInc, connInc)
+	return nil
+}
+
+// handleTrailers ends a stream's request with a trailing header block.
+func (h *h2Conn) handleTrailers(s *h2Stream, f *http2.MetaHeadersFrame) {
+	h.mu.Lock()
+	if s.reset {
+		h.mu.Unlock()
+		return
+	}
+	code := http2.ErrCodeNo
+	switch {
+	case s.endStream:
+		code = http2.ErrCodeStreamClosed
+	case !f.StreamEnded() || len(f.PseudoFields()) > 0,
+		s.declared >= 0 && s.received != s.declared:
+		code = http2.ErrCodeProtocol
+	default:
+		for _, hf := range f.RegularFields() {
+			k := http.CanonicalHeaderKey(hf.Name)
+			if _, declared := s.trailer[k]; declared {
+				s.trailer[k] = append(s.trailer[k], hf.Value)
+			}
+		}
+		s.size += int64(f.Length)
+		s.endStream = true
+		if s.bodyErr == nil {
+			s.bodyErr = io.EOF
+		}
+		h.cond.Broadcast()
+	}
+	h.mu.Unlock()
+	if code != http2.ErrCodeNo {
+		h.resetStream(s.id, code)
+	}
+}
+
+func (h *h2Conn) handleWindowUpdate(f *http2.WindowUpdateFrame) error {
+	inc := int64(f.Increment)
+	h.mu.Lock()
+	if f.StreamID == 0 {
+		h.sendWindow += inc
+		overflow := h.sendWindow > h2MaxWindow
+		h.cond.Broadcast()
+		h.mu.Unlock()
+		if overflow {
+			return http2.ConnectionError(http2.ErrCodeFlowControl)
+		}
+		return nil
+	}
+	s, idle := h.streams[f.StreamID], f.StreamID > h.maxStreamID
+	overflow := false
+	if s != nil {
+		s.sendWindow += inc
+		overflow = s.sendWindow > h2MaxWindow
+		h.cond.Broadcast()
+	}
+	h.mu.Unlock()
+	switch {
+	case idle:
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	case overflow:
+		h.resetStream(f.StreamID, http2.ErrCodeFlowControl)
+	}
+	return nil
+}
+
+// handleReset stops a stream the client has given up on. Its handler keeps counting
+// towards the stream limit until it returns.
+func (h *h2Conn) handleReset(f *http2.RSTStreamFrame) error {
+	h.mu.Lock()
+	s, idle := h.streams[f.StreamID], f.StreamID > h.maxStreamID
+	if s != nil {
+		s.abort()
+		h.cond.Broadcast()
+	}
+	h.mu.Unlock()
+	if idle {
+		return http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+	return nil
+}
+
+// resetStream sends RST_STREAM and fails the stream's pending reads and writes.
+func (h *h2Conn) resetStream(id uint32, code http2.ErrCode) {
+	h.mu.Lock()
+	if s := h.streams[id]; s != nil {
+		s.abort()
+		h.cond.Broadcast()
+	}
+	h.mu.Unlock()
+	_ = h.write(func(fr *http2.Framer) error { return fr.WriteRSTStream(id, code) })
+}
+
+// closeStream forgets a stream once its response is done. A request body the client is
+// still sending is cut short with RST_STREAM (RFC 9113 §8.1), and what the handler left
+// unread returns to the connection window.
+func (h *h2Conn) closeStream(s *h2Stream) {
+	h.mu.Lock()
+	delete(h.streams, s.id)
+	unfinished := !s.endStream && !s.reset
+	s.abort()
+	_, connInc := h.credit(nil, int64(s.body.Len())+s.recvPending)
+	s.body = bytes.Buffer{}
+	idle := len(h.streams) == 0
+	if idle && !h.closed {
+		h.e.ReportConnState(h.conn, h.state, http.StateIdle)
+	}
+	closing := idle && h.goingAway
+	h.mu.Unlock()
+
+	h.writeWindowUpdates(0, 0, connInc)
+	if unfinished {
+		_ = h.write(func(fr *http2.Framer) error { return fr.WriteRSTStream(s.id, http2.ErrCodeNo) })
+	}
+	if closing {
+		h.wmu.Lock()
+		_ = h.state.Writer.Flush()
+		h.wmu.Unlock()
+		h.conn.Close()
+	}
+}
+
+// credit records n received bytes the server is done with and returns the window
+// increments now due for the stream and the connection. h.mu must be held.
+func (h *h2Conn) credit(s *h2Stream, n int64) (streamInc, connInc uint32) {
+	h.recvPending += n
+	if h.recvPending >= h2ConnWindow/4 {
+		connInc = uint32(h.recvPending)
+		h.recvWindow += h.recvPending
+		h.recvPending = 0
+	}
+	if s != nil && !s.endStream && !s.reset {
+		s.recvPending += n
+		if s.recvPending >= h2StreamWindow/4 {
+			streamInc = uint32(s.recvPending)
+			s.recvWindow += s.recvPending
+			s.recvPending = 0
+		}
+	}
+	return streamInc, connInc
+}
+
+// writeWindowUpdates sends the increments returned by credit.
+func (h *h2Conn) writeWindowUpdates(id, streamInc, connInc uint32) {
+	if streamInc == 0 && connInc == 0 {
+		return
+	}
+	_ = h.write(func(fr *http2.Framer) error {
+		if connInc > 0 {
+			if err := fr.WriteWindowUpdate(0, connInc); err != nil {
+				return err
+			}
+		}
+		if streamInc > 0 {
+			return fr.WriteWindowUpdate(id, streamInc)
+		}
+		return nil
+	})
+}
+
+// goAway sends GOAWAY, so the client opens no more streams, and closes the connection
+// once the streams already open are done.
+func (h *h2Conn) goAway() {
+	h.mu.Lock()
+	if h.goingAway || h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.goingAway = true
+	last, idle := h.maxStreamID, len(h.streams) == 0
+	h.mu.Unlock()
+
+	h.wmu.Lock()
+	_ = h.fr.WriteGoAway(last, http2.ErrCodeNo, nil)
+	_ = h.state.Writer.Flush()
+	h.wmu.Unlock()
+	if idle {
+		h.conn.Close()
+	}
+}
+
+// fail closes the connection after a connection error, reporting it with GOAWAY.
+func (h *h2Conn) fail(err error) {
+	code := http2.ErrCodeProtocol
+	var ce http2.ConnectionError
+	if errors.As(err, &ce) {
+		code = http2.ErrCode(ce)
+	}
+	h.mu.Lock()
+	last := h.maxStreamID
+	h.mu.Unlock()
+	h.wmu.Lock()
+	_ = h.fr.WriteGoAway(last, code, nil)
+	_ = h.state.Writer.Flush()
+	h.wmu.Unlock()
+	h.conn.Close()
+}
+
+// abort fails every stream once the connection has closed.
+func (h *h2Conn) abort() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	for _, s := range h.streams {
+		s.abort()
+	}
+	h.cond.Broadcast()
+	h.mu.Unlock()
+	close(h.done)
+}
+
+// write runs fn with the Framer under the write lock, then flushes the connection
+// unless the processing goroutine will once it is done with the input.
+func (h *h2Conn) write(fn func(fr *http2.Framer) error) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+	if err := fn(h.fr); err != nil {
+		return err
+	}
+	if h.batching {
+		return nil
+	}
+	return h.state.Writer.Flush()
+}
@@ -0,0 +1,516 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2WriteBuffer is how much response body is held before it goes out as DATA frames.
+const h2WriteBuffer = 16 << 10
+
+// errH2Malformed resets a stream whose request is malformed (RFC 9113 §8.1.1).
+var errH2Malformed = errors.New("engine: malformed HTTP/2 request")
+
+// h2Stream is a request/response exchange on an HTTP/2 connection.
+type h2Stream struct {
+	h      *h2Conn
+	id     uint32
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Guarded by h.mu.
+	body        bytes.Buffer // Request body received but not yet read by the handler.
+	bodyErr     error        // Returned once body is drained: io.EOF or *http.MaxBytesError.
+	trailer     http.Header  // Request trailers the client declared, filled in at END_STREAM.
+	endStream   bool         // The client has sent END_STREAM.
+	reset       bool         // Reset or closed; body reads and response writes fail.
+	declared    int64        // Content-Length of the request, or -1.
+	received    int64        // Request body bytes received.
+	limit       int64        // Body bytes the handler may read: the route's, or set with SetMaxRequestBodySize.
+	hasBody     bool         // The request has a body, so its limit may be changed.
+	size        int64        // Frame bytes the request took, for Stats.RequestSize.
+	recvWindow  int64
+	recvPending int64
+	sendWindow  int64
+}
+
+// abort fails the stream's pending reads and writes. h.mu must be held.
+func (s *h2Stream) abort() {
+	s.reset = true
+	s.cancel()
+}
+
+// serveH2Stream runs a stream's request through admission control and the Handler,
+// the same way handleRequest runs an HTTP/1 request, and then ends the stream.
+func (e *Engine) serveH2Stream(h *h2Conn, s *h2Stream, req *http.Request) {
+	defer e.ReleaseConnectionState(h.state)
+	defer h.closeStream(s)
+
+	w := &h2Response{s: s, req: req, header: make(http.Header)}
+	admission, err := e.admit(req.Context(), req.URL.Path)
+	if err != nil {
+		if err != context.Canceled {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = w.EndResponse()
+		}
+		return
+	}
+	defer admission.release()
+	e.stats.requests.Add(1)
+
+	start := time.Now()
+	if e.serveHandler(h.conn, h.state, w, req) || w.EndResponse() != nil {
+		// The client must not take a cut-off response for a complete one.
+		if !w.ended {
+			h.resetStream(s.id, http2.ErrCodeInternal)
+		}
+		return
+	}
+	e.stats.requestDuration.observe(uint64(time.Since(start)))
+	h.mu.Lock()
+	size := s.size
+	h.mu.Unlock()
+	e.stats.requestSize.observe(uint64(size))
+}
+
+// newRequest builds the request for a stream from its header block. A non-zero status
+// rejects the request with that response; an error resets the stream as malformed.
+func (h *h2Conn) newRequest(s *h2Stream, f *http2.MetaHeadersFrame) (*http.Request, int, error) {
+	method, path := f.PseudoValue("method"), f.PseudoValue("path")
+	scheme, authority := f.PseudoValue("scheme"), f.PseudoValue("authority")
+	if method == "" || method == http.MethodConnect && authority == "" ||
+		method != http.MethodConnect && (path == "" || scheme == "") {
+		return nil, 0, errH2Malformed
+	}
+
+	fields := f.RegularFields()
+	header := make(http.Header, len(fields))
+	for _, hf := range fields {
+		k := http.CanonicalHeaderKey(hf.Name)
+		header[k] = append(header[k], hf.Value)
+	}
+	// Connection-specific fields have no meaning in HTTP/2 (RFC 9113 §8.2.2).
+	for _, k := range []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade"} {
+		if _, ok := header[k]; ok {
+			return nil, 0, errH2Malformed
+		}
+	}
+	if te := header["Te"]; len(te) > 0 && (len(te) > 1 || te[0] != "trailers") {
+		return nil, 0, errH2Malformed
+	}
+	// Cookies may be split across fields to compress better (RFC 9113 §8.2.3).
+	if cookies := header["Cookie"]; len(cookies) > 1 {
+		header["Cookie"] = []string{strings.Join(cookies, "; ")}
+	}
+	if authority == "" {
+		authority = header.Get("Host")
+	}
+
+	req := &http.Request{
+		Method:        method,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        header,
+		Host:          authority,
+		RequestURI:    path,
+		RemoteAddr:    h.state.RemoteAddr,
+		ContentLength: -1,
+	}
+	var err error
+	if method == http.MethodConnect {
+		req.URL, req.RequestURI = &url.URL{Host: authority}, authority
+	} else if req.URL, err = url.ParseRequestURI(path); err != nil {
+		return nil, 0, errH2Malformed
+	}
+	if cl := header.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseUint(cl, 10, 63)
+		if err != nil || len(header["Content-Length"]) > 1 {
+			return nil, 0, errH2Malformed
+		}
+		s.declared = int64(n)
+		req.ContentLength = s.declared
+	}
+	for _, v := range header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			if k = http.CanonicalHeaderKey(textproto.TrimString(k)); k != "" && httpguts.ValidTrailerHeader(k) {
+				if req.Trailer == nil {
+					req.Trailer = make(http.Header)
+				}
+				req.Trailer[k] = nil
+			}
+		}
+	}
+
+	if f.StreamEnded() {
+		if s.declared > 0 {
+			return nil, 0, errH2Malformed
+		}
+		req.Body, req.ContentLength = http.NoBody, 0
+	} else {
+		req.Body = h2Body{s}
+		h.mu.Lock()
+		s.trailer = req.Trailer
+		s.hasBody = true
+		h.mu.Unlock()
+	}
+	req = req.WithContext(s.ctx)
+	limit := h.e.maxBodySizeFor([]byte(path))
+	h.mu.Lock()
+	s.limit = limit
+	h.mu.Unlock()
+
+	// The limits the reactor enforces on HTTP/1 requests.
+	switch limits := &h.e.parser; {
+	case f.Truncated, limits.MaxHeaderCount > 0 && len(fields) > limits.MaxHeaderCount:
+		return req, http.StatusRequestHeaderFieldsTooLarge, nil
+	case limit > 0 && s.declared > limit:
+		return req, http.StatusRequestEntityTooLarge, nil
+	}
+	return req, 0, nil
+}
+
+// h2Body is the body of a request received on an HTTP/2 stream. Reads hand flow
+// control credit back to the client as the handler consumes the data.
+type h2Body struct {
+	s *h2Stream
+}
+
+func (b h2Body) Read(p []byte) (int, error) {
+	s, h := b.s, b.s.h
+	h.mu.Lock()
+	for !s.reset && s.body.Len() == 0 && s.bodyErr == nil {
+		h.cond.Wait()
+	}
+	if s.reset {
+		h.mu.Unlock()
+		return 0, errH2StreamClosed
+	}
+	if s.body.Len() == 0 {
+		err := s.bodyErr
+		h.mu.Unlock()
+		return 0, err
+	}
+	if s.limit > 0 {
+		// Like the HTTP/1 body, the limit applies to what the handler reads, so it may
+		// still be changed after the body has started arriving.
+		read := s.received - int64(s.body.Len())
+		if read >= s.limit {
+			err := &http.MaxBytesError{Limit: s.limit}
+			s.bodyErr = err
+			streamInc, connInc := h.credit(s, int64(s.body.Len()))
+			s.body.Reset()
+			h.mu.Unlock()
+			h.writeWindowUpdates(s.id, streamInc, connInc)
+			return 0, err
+		}
+		if remaining := s.limit - read; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, _ := s.body.Read(p)
+	streamInc, connInc := h.credit(s, int64(n))
+	h.mu.Unlock()
+	h.writeWindowUpdates(s.id, streamInc, connInc)
+	return n, nil
+}
+
+func (b h2Body) Close() error {
+	return nil
+}
+
+// setBodyLimit changes how much of the request body the handler may read. It reports
+// false if the request has no body.
+func (s *h2Stream) setBodyLimit(n int64) bool {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	if !s.hasBody {
+		return false
+	}
+	s.limit = n
+	return true
+}
+
+// h2Response is the http.ResponseWriter of an HTTP/2 stream. Body writes are buffered
+// and sent as DATA frames within the client's flow control windows.
+type h2Response struct {
+	s         *h2Stream
+	req       *http.Request
+	header    http.Header
+	status    int
+	sent      bool // HEADERS has been written.
+	ended     bool // END_STREAM has been written.
+	buf       []byte
+	headBytes int64 // Body bytes written in answer to HEAD, for Content-Length.
+	err       error
+}
+
+func (w *h2Response) Header() http.Header {
+	return w.header
+}
+
+func (w *h2Response) WriteHeader(code int) {
+	if w.sent || w.status != 0 {
+		return
+	}
+	if code >= 100 && code < 200 {
+		// Informational responses go out at once and leave the final status open.
+		if w.err == nil {
+			w.err = w.s.h.writeHeaders(w.s, code, w.header, "", false)
+		}
+		return
+	}
+	w.status = code
+}
+
+func (w *h2Response) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowedForStatus(w.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if w.req.Method == http.MethodHead {
+		w.headBytes += int64(len(p))
+		return len(p), nil
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= h2WriteBuffer {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *h2Response) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends the headers and the buffered body.
+func (w *h2Response) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = w.flush()
+}
+
+func (w *h2Response) flush() error {
+	if w.err != nil || w.ended {
+		return w.err
+	}
+	if !w.sent {
+		if w.err = w.s.h.writeHeaders(w.s, w.status, w.header, "", false); w.err != nil {
+			return w.err
+		}
+		w.sent = true
+	}
+	if len(w.buf) > 0 {
+		w.err = w.s.h.writeData(w.s, w.buf, false)
+		w.buf = w.buf[:0]
+	}
+	return w.err
+}
+
+// HeaderSent reports whether the response headers have been written.
+func (w *h2Response) HeaderSent() bool {
+	return w.sent
+}
+
+// EndResponse sends what remains of the response and ends the stream.
+func (w *h2Response) EndResponse() error {
+	if w.ended || w.err != nil {
+		return w.err
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h, trailer := w.s.h, w.trailer()
+	if !w.sent {
+		// The whole body is known, so its length can be announced.
+		var contentLength string
+		if w.header.Get("Content-Length") == "" {
+			switch {
+			case w.req != nil && w.req.Method == http.MethodHead:
+				if w.headBytes > 0 {
+					contentLength = strconv.FormatInt(w.headBytes, 10)
+				}
+			case bodyAllowedForStatus(w.status):
+				contentLength = strconv.Itoa(len(w.buf))
+			}
+		}
+		end := len(w.buf) == 0 && trailer == nil
+		if w.err = h.writeHeaders(w.s, w.status, w.header, contentLength, end); w.err != nil {
+			return w.err
+		}
+		w.sent = true
+		if end {
+			w.ended = true
+			return nil
+		}
+	}
+	if w.err = h.writeData(w.s, w.buf, trailer == nil); w.err != nil {
+		return w.err
+	}
+	w.buf = w.buf[:0]
+	if trailer != nil {
+		if w.err = h.writeHeaders(w.s, 0, trailer, "", true); w.err != nil {
+			return w.err
+		}
+	}
+	w.ended = true
+	return nil
+}
+
+// trailer collects the trailers the handler declared or set with http.TrailerPrefix.
+func (w *h2Response) trailer() http.Header {
+	var t http.Header
+	add := func(k string, v []string) {
+		if t == nil {
+			t = make(http.Header)
+		}
+		t[k] = v
+	}
+	for _, v := range w.header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			k = http.CanonicalHeaderKey(textproto.TrimString(k))
+			if vv, ok := w.header[k]; ok {
+				add(k, vv)
+			}
+		}
+	}
+	for k, vv := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			add(http.CanonicalHeaderKey(k[len(http.TrailerPrefix):]), vv)
+		}
+	}
+	return t
+}
+
+// bodyAllowedForStatus reports whether the status code permits a response body (RFC 9110 §6.4.1).
+func bodyAllowedForStatus(status int) bool {
+	return !(status >= 100 && status < 200 || status == http.StatusNoContent || status == http.StatusNotModified)
+}
+
+// h2IgnoredHeaders are not sent in HTTP/2 responses: connection-specific fields and
+// the trailer declaration, which is only meaningful to HTTP/1 chunked framing.
+var h2IgnoredHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Trailer":           true,
+}
+
+// writeHeaders writes a header block on s: a response header when status is set, or
+// trailers. The block is split into CONTINUATION frames to fit the client's frame size.
+func (h *h2Conn) writeHeaders(s *h2Stream, status int, header http.Header, contentLength string, end bool) error {
+	h.mu.Lock()
+	maxFrame, gone := h.maxFrame, s.reset || h.closed
+	h.mu.Unlock()
+	if gone {
+		return errH2StreamClosed
+	}
+
+	return h.write(func(fr *http2.Framer) error {
+		h.hbuf.Reset()
+		if status != 0 {
+			h.encode(":status", strconv.Itoa(status))
+			if header.Get("Date") == "" {
+				h.encode("date", time.Now().UTC().Format(http.TimeFormat))
+			}
+			if contentLength != "" {
+				h.encode("content-length", contentLength)
+			}
+		}
+		for k, vv := range header {
+			if h2IgnoredHeaders[k] || strings.HasPrefix(k, http.TrailerPrefix) || !httpguts.ValidHeaderFieldName(k) {
+				continue
+			}
+			name := strings.ToLower(k)
+			for _, v := range vv {
+				if httpguts.ValidHeaderFieldValue(v) {
+					h.encode(name, v)
+				}
+			}
+		}
+
+		block := h.hbuf.Bytes()
+		for first := true; first || len(block) > 0; first = false {
+			chunk := block[:min(len(block), maxFrame)]
+			block = block[len(chunk):]
+			var err error
+			if first {
+				err = fr.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      s.id,
+					BlockFragment: chunk,
+					EndStream:     end,
+					EndHeaders:    len(block) == 0,
+				})
+			} else {
+				err = fr.WriteContinuation(s.id, len(block) == 0, chunk)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// encode adds a header field to the block being built. h.wmu must be held.
+func (h *h2Conn) encode(name, value string) {
+	_ = h.enc.WriteField(hpack.HeaderField{Name: name, Value: value})
+}
+
+// writeData sends p on s as DATA frames, waiting for the client to open its flow
+// control windows as needed. end sets END_STREAM on the last frame.
+func (h *h2Conn) writeData(s *h2Stream, p []byte, end bool) error {
+	for {
+		n, err := h.reserve(s, len(p))
+		if err != nil {
+			return err
+		}
+		last := end && n == len(p)
+		if err := h.write(func(fr *http2.Framer) error { return fr.WriteData(s.id, last, p[:n]) }); err != nil {
+			return err
+		}
+		if p = p[n:]; len(p) == 0 {
+			return nil
+		}
+	}
+}
+
+// reserve takes up to want bytes from the connection and stream send windows, waiting
+// until both are open.
+func (h *h2Conn) reserve(s *h2Stream, want int) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for {
+		if s.reset || h.closed {
+			return 0, errH2StreamClosed
+		}
+		n := min(int64(want), int64(h.maxFrame), h.sendWindow, s.sendWindow)
+		if want == 0 || n > 0 {
+			n = max(n, 0)
+			h.sendWindow -= n
+			s.sendWindow -= n
+			return int(n), nil
+		}
+		h.cond.Wait()
+	}
+}
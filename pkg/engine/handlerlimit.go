@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serviceUnavailableResponse is written before closing a connection whose request
+// was shed for lack of capacity.
+var serviceUnavailableResponse = []byte("HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+
+var (
+	errLimitQueueFull = errors.New("handler limit queue is full")
+	errQueueTimeout   = errors.New("timed out waiting for a handler slot")
+)
+
+// HandlerLimit caps how many handlers run at once. It is a concurrency limit, not a
+// worker pool: handlers still run on the goroutine serving their connection (taken from
+// netpoll's goroutine pool for HTTP/1, one per stream for HTTP/2), and a request waiting
+// for a slot holds that goroutine. Requests beyond maxConcurrency wait in a FIFO queue
+// of up to maxQueue entries for at most queueTimeout (0 waits until the client goes
+// away); requests that do not fit or wait too long get "503 Service Unavailable" and
+// their connection is closed, so maxQueue also bounds the goroutines parked waiting.
+// A limit may be shared by several engines.
+// HandlerLimit은 동시에 실행되는 핸들러 수를 제한합니다. 워커 풀이 아니며 핸들러는 연결을 처리하는
+// 고루틴에서 실행되고, 대기 중인 요청도 그 고루틴을 점유합니다. 대기열이 가득 차거나 대기 시간이
+// 초과되면 503 응답을 받습니다.
+type HandlerLimit struct {
+	maxConcurrency int
+	maxQueue       int
+	queueTimeout   time.Duration
+
+	mu      sync.Mutex
+	running int
+	queue   []chan struct{} // Waiters in arrival order; closed when handed a slot.
+
+	rejected atomic.Uint64
+	timedOut atomic.Uint64
+}
+
+// HandlerLimitStats is a snapshot of a HandlerLimit.
+// HandlerLimitStats는 HandlerLimit의 스냅샷입니다.
+type HandlerLimitStats struct {
+	Running  int    // Handlers holding a slot. // 슬롯을 점유한 핸들러 수입니다.
+	Queued   int    // Requests waiting for a slot. // 슬롯을 기다리는 요청 수입니다.
+	Rejected uint64 // Requests refused because the queue was full.
+	TimedOut uint64 // Requests refused after waiting queueTimeout.
+}
+
+// NewHandlerLimit creates a limit letting at most maxConcurrency handlers run at once.
+// NewHandlerLimit은 최대 maxConcurrency개의 핸들러를 동시에 실행하도록 하는 제한을 생성합니다.
+func NewHandlerLimit(maxConcurrency, maxQueue int, queueTimeout time.Duration) *HandlerLimit {
+	return &HandlerLimit{
+		maxConcurrency: max(maxConcurrency, 1),
+		maxQueue:       max(maxQueue, 0),
+		queueTimeout:   queueTimeout,
+	}
+}
+
+// Stats returns a snapshot of the limit's occupancy and counters.
+// Stats는 제한의 점유 상태와 카운터 스냅샷을 반환합니다.
+func (p *HandlerLimit) Stats() HandlerLimitStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return HandlerLimitStats{
+		Running:  p.running,
+		Queued:   len(p.queue),
+		Rejected: p.rejected.Load(),
+		TimedOut: p.timedOut.Load(),
+	}
+}
+
+// acquire takes a slot, waiting in the queue if none is free. It fails if the queue is
+// full, the queue timeout passes or ctx is done first.
+func (p *HandlerLimit) acquire(ctx context.Context) error {
+	p.mu.Lock()
+	if p.running < p.maxConcurrency {
+		p.running++
+		p.mu.Unlock()
+		return nil
+	}
+	if len(p.queue) >= p.maxQueue {
+		p.mu.Unlock()
+		p.rejected.Add(1)
+		return errLimitQueueFull
+	}
+	ready := make(chan struct{})
+	p.queue = append(p.queue, ready)
+	p.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if p.queueTimeout > 0 {
+		t := time.NewTimer(p.queueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timeout:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, q := range p.queue {
+		if q == ready {
+			copy(p.queue[i:], p.queue[i+1:])
+			p.queue[len(p.queue)-1] = nil
+			p.queue = p.queue[:len(p.queue)-1]
+			if err == errQueueTimeout {
+				p.timedOut.Add(1)
+			}
+			return err
+		}
+	}
+	// A slot was handed over while giving up; keep it.
+	return nil
+}
+
+// release frees a slot, handing it to the oldest waiter if there is one.
+func (p *HandlerLimit) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 {
+		p.running--
+		return
+	}
+	ready := p.queue[0]
+	p.queue[0] = nil
+	p.queue = p.queue[1:]
+	close(ready)
+}
+
+// sendServiceUnavailable writes the response to a request shed for lack of capacity.
+func (s *ConnectionState) sendServiceUnavailable() {
+	_, _ = s.Writer.Write(serviceUnavailableResponse)
+	_ = s.Writer.Flush()
+}
+
+// WithHandlerLimit caps every handler with p, except requests routed elsewhere by
+// WithPathHandlerLimit.
+// WithHandlerLimit은 모든 핸들러의 동시 실행 수를 p로 제한합니다.
+func WithHandlerLimit(p *HandlerLimit) Option {
+	return func(e *Engine) {
+		e.handlerLimit = p
+	}
+}
+
+// WithPathHandlerLimit caps handlers for requests whose URL path starts with prefix
+// with p, so slow routes cannot take the slots of fast ones. The longest matching
+// prefix wins; requests matching none use the WithHandlerLimit limit, if any.
+// WithPathHandlerLimit은 URL 경로가 prefix로 시작하는 요청의 핸들러를 p로 제한합니다.
+func WithPathHandlerLimit(prefix string, p *HandlerLimit) Option {
+	return func(e *Engine) {
+		e.pathLimits = append(e.pathLimits, pathLimit{prefix: prefix, limit: p})
+	}
+}
+
+// admission is a request's hold on the adaptive limit and its handler limit.
+type admission struct {
+	limiter  *AdaptiveLimiter
+	inFlight int
+	start    time.Time
+	handlers *HandlerLimit
+}
+
+// admit lets a request for path past the adaptive limit and into its handler limit,
+// failing if either refuses it or ctx is done while it waits.
+func (e *Engine) admit(ctx context.Context, path string) (admission, error) {
+	var a admission
+	if l := e.limiter; l != nil {
+		inFlight, ok := l.acquire()
+		if !ok {
+			return a, errConcurrencyLimit
+		}
+		a.limiter, a.inFlight, a.start = l, inFlight, time.Now()
+	}
+	if h := e.limitFor(path); h != nil {
+		if err := h.acquire(ctx); err != nil {
+			a.release()
+			return admission{}, err
+		}
+		a.handlers = h
+	}
+	return a, nil
+}
+
+// release ends the request, feeding its latency to the adaptive limit.
+func (a *admission) release() {
+	if a.handlers != nil {
+		a.handlers.release()
+	}
+	if a.limiter != nil {
+		a.limiter.release(time.Since(a.start), a.inFlight)
+	}
+}
+
+// pathLimit caps handlers for requests under prefix with limit.
+type pathLimit struct {
+	prefix string
+	limit  *HandlerLimit
+}
+
+// limitFor returns the limit capping handlers for path, or nil if they run unbounded.
+func (e *Engine) limitFor(path string) *HandlerLimit {
+	limit, matched := e.handlerLimit, -1
+	for _, pl := range e.pathLimits {
+		if len(pl.prefix) > matched && strings.HasPrefix(path, pl.prefix) {
+			limit, matched = pl.limit, len(pl.prefix)
+		}
+	}
+	return limit
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errConcurrencyLimit = errors.New("adaptive concurrency limit reached")
+
+// LimitAlgorithm selects how an AdaptiveLimiter moves its limit.
+// LimitAlgorithm은 AdaptiveLimiter가 제한값을 조정하는 방식을 선택합니다.
+type LimitAlgorithm int
+
+const (
+	// LimitGradient compares each handler latency with a slowly moving baseline and
+	// shrinks the limit as latency grows past it, like Netflix's Gradient2.
+	// LimitGradient는 핸들러 지연 시간을 장기 기준값과 비교하여 제한을 조정합니다.
+	LimitGradient LimitAlgorithm = iota
+	// LimitAIMD grows the limit by one while latency stays under LatencyThreshold and
+	// cuts it by Backoff when it does not.
+	// LimitAIMD는 지연 시간이 임계값 미만이면 제한을 1씩 늘리고, 초과하면 Backoff 비율로 줄입니다.
+	LimitAIMD
+)
+
+// AdaptiveLimitConfig configures an AdaptiveLimiter. Zero fields take the defaults noted.
+// AdaptiveLimitConfig는 AdaptiveLimiter를 설정합니다. 0인 필드는 기본값을 사용합니다.
+type AdaptiveLimitConfig struct {
+	Algorithm    LimitAlgorithm
+	InitialLimit int // Default 20.
+	MinLimit     int // Default 1.
+	MaxLimit     int // Default 1000.
+
+	// Tolerance is how many times the baseline latency LimitGradient accepts before
+	// shrinking the limit. Default 1.5.
+	Tolerance float64
+
+	// LatencyThreshold is the handler latency above which LimitAIMD backs off.
+	// Default 100ms.
+	LatencyThreshold time.Duration
+	// Backoff is the factor LimitAIMD multiplies the limit by when backing off. Default 0.9.
+	Backoff float64
+}
+
+// AdaptiveLimiterStats is a snapshot of an AdaptiveLimiter.
+// AdaptiveLimiterStats는 AdaptiveLimiter의 스냅샷입니다.
+type AdaptiveLimiterStats struct {
+	Limit    int    // Current in-flight request limit. // 현재 동시 처리 요청 제한입니다.
+	InFlight int    // Requests currently admitted. // 현재 처리 중인 요청 수입니다.
+	Rejected uint64 // Requests shed with 503 because the limit was reached.
+}
+
+// AdaptiveLimiter caps in-flight requests at a limit it derives from measured handler
+// latency, so an overloaded server sheds load with "503 Service Unavailable" before
+// queueing drives latency up for everyone. Admission is a pair of atomics; the limit
+// is recomputed as each admitted request completes.
+// AdaptiveLimiter는 측정된 핸들러 지연 시간으로 동시 처리 요청 수 제한을 동적으로 조정하고,
+// 제한을 넘는 요청은 503으로 거부합니다.
+type AdaptiveLimiter struct {
+	cfg AdaptiveLimitConfig
+
+	limit    atomic.Int64 // Published copy of estimate.
+	inFlight atomic.Int64
+	rejected atomic.Uint64
+
+	mu       sync.Mutex
+	estimate float64 // Current limit before rounding.
+	baseline float64 // LimitGradient's long-term latency, in nanoseconds.
+	samples  int
+}
+
+const (
+	gradientSmoothing = 0.2 // Weight of each new limit estimate.
+	baselineWindow    = 600 // Samples averaged into the baseline latency.
+	baselineWarmup    = 10  // Samples averaged evenly before the baseline starts moving slowly.
+)
+
+// NewAdaptiveLimiter creates a limiter from cfg.
+// NewAdaptiveLimiter는 cfg로 제한기를 생성합니다.
+func NewAdaptiveLimiter(cfg AdaptiveLimitConfig) *AdaptiveLimiter {
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 1000
+	}
+	cfg.MaxLimit = max(cfg.MaxLimit, cfg.MinLimit)
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = 20
+	}
+	cfg.InitialLimit = min(max(cfg.InitialLimit, cfg.MinLimit), cfg.MaxLimit)
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 1.5
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = 100 * time.Millisecond
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.9
+	}
+	l := &AdaptiveLimiter{cfg: cfg, estimate: float64(cfg.InitialLimit)}
+	l.limit.Store(int64(cfg.InitialLimit))
+	return l
+}
+
+// Stats returns the limiter's current limit and counters.
+// Stats는 제한기의 현재 제한값과 카운터를 반환합니다.
+func (l *AdaptiveLimiter) Stats() AdaptiveLimiterStats {
+	return AdaptiveLimiterStats{
+		Limit:    int(l.limit.Load()),
+		InFlight: int(l.inFlight.Load()),
+		Rejected: l.rejected.Load(),
+	}
+}
+
+// acquire admits a request if the limit allows it, returning the number of requests
+// in flight including it.
+func (l *AdaptiveLimiter) acquire() (int, bool) {
+	n := l.inFlight.Add(1)
+	if n > l.limit.Load() {
+		l.inFlight.Add(-1)
+		l.rejected.Add(1)
+		return 0, false
+	}
+	return int(n), true
+}
+
+// release ends an admitted request that took latency with inFlight requests running.
+func (l *AdaptiveLimiter) release(latency time.Duration, inFlight int) {
+	l.inFlight.Add(-1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch l.cfg.Algorithm {
+	case LimitAIMD:
+		l.updateAIMD(latency, inFlight)
+	default:
+		l.updateGradient(latency, inFlight)
+	}
+	l.estimate = min(max(l.estimate, float64(l.cfg.MinLimit)), float64(l.cfg.MaxLimit))
+	l.limit.Store(int64(l.estimate))
+}
+
+func (l *AdaptiveLimiter) updateGradient(latency time.Duration, inFlight int) {
+	rtt := float64(max(latency, 1))
+	if l.samples++; l.samples <= baselineWarmup {
+		l.baseline += (rtt - l.baseline) / float64(l.samples)
+	} else {
+		l.baseline += (rtt - l.baseline) * 2 / (baselineWindow + 1)
+	}
+	// Let the baseline recover quickly once a latency spike is over.
+	if l.baseline/rtt > 2 {
+		l.baseline *= 0.95
+	}
+	// Latency says little about capacity while the limit is far from being used.
+	if float64(inFlight) < l.estimate/2 {
+		return
+	}
+	gradient := max(0.5, min(1, l.cfg.Tolerance*l.baseline/rtt))
+	// The square root of the limit leaves room for a small queue, so the limit keeps
+	// probing upwards while latency holds.
+	next := l.estimate*gradient + math.Sqrt(l.estimate)
+	l.estimate = l.estimate*(1-gradientSmoothing) + next*gradientSmoothing
+}
+
+func (l *AdaptiveLimiter) updateAIMD(latency time.Duration, inFlight int) {
+	switch {
+	case latency > l.cfg.LatencyThreshold:
+		l.estimate *= l.cfg.Backoff
+	case float64(inFlight)*2 >= l.estimate:
+		l.estimate++
+	}
+}
+
+// WithAdaptiveLimit makes the engine admit requests through l, answering those over its
+// current limit with "503 Service Unavailable" and closing their connection. The
+// latency it learns from spans the handler and any wait for a WithHandlerLimit slot.
+// Stats reports the current limit and the number of requests shed.
+// WithAdaptiveLimit는 l을 통해 요청을 받아들이며, 현재 제한을 넘는 요청에는 503으로 응답합니다.
+func WithAdaptiveLimit(l *AdaptiveLimiter) Option {
+	return func(e *Engine) {
+		e.limiter = l
+	}
+}
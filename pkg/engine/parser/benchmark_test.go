@@ -1,6 +1,9 @@
 package parser
 
 import (
+	"bufio"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +24,26 @@ func BenchmarkCheckRequest_ContentLength(b *testing.B) {
 		CheckRequest(data)
 	}
 }
+
+func BenchmarkParseRequest(b *testing.B) {
+	data := []byte("GET /api/v1/users?id=42 HTTP/1.1\r\nHost: example.com\r\nUser-Agent: bench\r\nAccept: */*\r\nConnection: keep-alive\r\n\r\n")
+	var r Request
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseRequest(data, &r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadRequest(b *testing.B) {
+	data := "GET /api/v1/users?id=42 HTTP/1.1\r\nHost: example.com\r\nUser-Agent: bench\r\nAccept: */*\r\nConnection: keep-alive\r\n\r\n"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := http.ReadRequest(bufio.NewReader(strings.NewReader(data))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"strconv"
 )
 
@@ -10,61 +11,295 @@ const maxInt64 = int64(^uint64(0) >> 1)
 
 var (
 	headerEnd  = []byte("\r\n\r\n")
+	crlf       = []byte("\r\n")
 	headerCL   = []byte("Content-Length:")
 	headerTE   = []byte("Transfer-Encoding:")
+	headerExp  = []byte("Expect:")
+	val100     = []byte("100-continue")
 	valChunked = []byte("chunked")
 )
 
 type CheckResult struct {
 	Complete      bool // 요청이 완전히 수신되었는가?
 	BytesConsumed int  // 요청 전체의 길이 (Header + Body)
+	HeaderLength  int  // Length of the header block including the blank line; 0 until it has arrived. // 헤더 블록 길이
 	Error         error
+
+	// ExpectContinue is set when the headers carry "Expect: 100-continue" and the body
+	// has not fully arrived, i.e. the client may be waiting for an interim response.
+	ExpectContinue bool
 }
 
 const MaxHeaderSize = 8 * 1024 // 8KB
 
+var (
+	// ErrHeaderTooLarge is returned when the header block exceeds Config.MaxHeaderSize.
+	ErrHeaderTooLarge = errors.New("parser: request header too large")
+	// ErrTooManyHeaders is returned when a request has more than Config.MaxHeaderCount header lines.
+	ErrTooManyHeaders = errors.New("parser: too many request headers")
+	// ErrBodyTooLarge is returned when the declared body exceeds Config.MaxBodySize.
+	ErrBodyTooLarge = errors.New("parser: request body too large")
+)
+
+// Framing errors reported in strict mode (Config.Strict). Each one marks a request whose
+// length different parsers could disagree on, the basis of request smuggling.
+// Strict 모드에서 반환되는 프레이밍 오류입니다.
+var (
+	ErrContentLengthWithTE    = errors.New("parser: request has both Content-Length and Transfer-Encoding")
+	ErrDuplicateContentLength = errors.New("parser: request has multiple Content-Length headers")
+	ErrChunkedNotFinal        = errors.New("parser: chunked is not the final transfer coding")
+	ErrObsFold                = errors.New("parser: obsolete line folding in request headers")
+	ErrBareLF                 = errors.New("parser: bare LF in request headers")
+)
+
+// Config holds the limits applied by Config.CheckRequest.
+// Config는 CheckRequest가 적용하는 제한 값을 담습니다.
+type Config struct {
+	MaxHeaderSize  int   // Maximum header block size in bytes; 0 means MaxHeaderSize. // 헤더 블록 최대 크기
+	MaxHeaderCount int   // Maximum number of header lines; 0 means no limit. // 헤더 줄 최대 개수
+	MaxBodySize    int64 // Maximum body size in bytes; 0 means no limit. // 본문 최대 크기
+
+	// MaxBodySizeFor, if set, returns the body size limit for a request given its
+	// request target, in place of MaxBodySize; 0 means no limit.
+	// MaxBodySizeFor는 요청 대상별 본문 최대 크기를 반환합니다(MaxBodySize 대신 사용).
+	MaxBodySizeFor func(target []byte) int64
+
+	// Strict rejects requests with ambiguous framing instead of guessing: Content-Length
+	// together with Transfer-Encoding, repeated Content-Length, a Transfer-Encoding whose
+	// final coding is not chunked, obs-folded header lines and bare LF line endings.
+	// Strict는 모호한 프레이밍을 가진 요청을 거부합니다(요청 스머글링 방지).
+	Strict bool
+}
+
+var defaultConfig = Config{MaxHeaderSize: MaxHeaderSize}
+
+// CheckRequest checks data with the default limits.
 func CheckRequest(data []byte) CheckResult {
+	return defaultConfig.CheckRequest(data)
+}
+
+// HeaderSizeLimit returns the effective maximum header block size.
+func (c *Config) HeaderSizeLimit() int {
+	if c.MaxHeaderSize > 0 {
+		return c.MaxHeaderSize
+	}
+	return MaxHeaderSize
+}
+
+// CheckRequest reports whether data holds a complete request and how long it is.
+// CheckRequest는 data에 완전한 요청이 있는지와 그 길이를 반환합니다.
+func (c *Config) CheckRequest(data []byte) CheckResult {
+	var f Framing
+	return c.Resume(&f, data)
+}
+
+// Framing records how far Resume has validated a partially received request, so that
+// a later call with more data picks up where the previous one stopped instead of
+// rescanning the headers and every chunk from the first byte. The zero value starts a
+// new request; Reset it once the request is dispatched or rejected.
+// Framing은 부분적으로 수신된 요청을 어디까지 검증했는지 기록합니다.
+type Framing struct {
+	scanned   int   // Bytes already searched for the pending delimiter.
+	headerLen int   // Header block length, including the blank line; 0 until found.
+	length    int64 // Declared Content-Length, or -1.
+	chunked   bool
+	expect    bool
+	next      int   // Start of the next chunk-size line, or of the trailer section.
+	chunkEnd  int   // End of the current chunk's data and CRLF; 0 between chunks.
+	bodySize  int64 // Sum of chunk sizes seen so far.
+	bodyLimit int64 // Body size limit for this request; 0 means no limit.
+	trailer   bool  // The last chunk has been seen.
+}
+
+// BodyLimit returns the body size limit the request is checked against, once its
+// headers have been scanned; 0 means no limit.
+func (f *Framing) BodyLimit() int64 {
+	return f.bodyLimit
+}
+
+// Reset prepares f for the next request.
+func (f *Framing) Reset() {
+	*f = Framing{}
+}
+
+// Resume is CheckRequest for a request that arrives in pieces. data must start at the
+// same byte on every call for the same f; a call with less data than an earlier one
+// reports the request as incomplete.
+// Resume은 이전 호출에서 검증을 멈춘 지점부터 이어서 CheckRequest를 수행합니다.
+func (c *Config) Resume(f *Framing, data []byte) CheckResult {
+	if f.headerLen == 0 {
+		if res, ok := c.scanHeader(f, data); !ok {
+			return res
+		}
+	}
+
+	incomplete := CheckResult{HeaderLength: f.headerLen, ExpectContinue: f.expect}
+	complete := func(n int) CheckResult {
+		return CheckResult{Complete: true, BytesConsumed: n, HeaderLength: f.headerLen}
+	}
+
+	// 3. 바디 완성 여부 판단
+	if !f.chunked {
+		if f.length >= 0 {
+			if int64(len(data)-f.headerLen) >= f.length {
+				return complete(f.headerLen + int(f.length))
+			}
+			return incomplete
+		}
+		// 바디가 없는 요청 (GET, HEAD 등)
+		return complete(f.headerLen)
+	}
+
+	for {
+		if f.trailer {
+			// Last chunk found. If there are no trailers, the next bytes are just CRLF.
+			if len(data) >= f.next+2 && bytes.HasPrefix(data[f.next:], crlf) {
+				return complete(f.next + 2)
+			}
+
+			// Otherwise, trailer section ends with CRLFCRLF.
+			from := max(f.scanned-len(headerEnd)+1, f.next)
+			if from > len(data) {
+				return incomplete
+			}
+			trailerEnd := bytes.Index(data[from:], headerEnd)
+			if trailerEnd == -1 {
+				f.scanned = max(f.scanned, len(data))
+				return incomplete
+			}
+			return complete(from + trailerEnd + len(headerEnd))
+		}
+
+		// Wait for the rest of the current chunk's data.
+		if f.chunkEnd > 0 {
+			if len(data) < f.chunkEnd {
+				return incomplete
+			}
+			f.next, f.scanned, f.chunkEnd = f.chunkEnd, f.chunkEnd, 0
+		}
+
+		// Find CRLF at end of chunk size line
+		from := max(f.scanned-1, f.next)
+		if from > len(data) {
+			return incomplete
+		}
+		idx := bytes.Index(data[from:], crlf)
+		if idx == -1 {
+			f.scanned = max(f.scanned, len(data))
+			return incomplete
+		}
+		lineEnd := from + idx
+
+		// Parse Chunk Size (hex)
+		// Handle Chunk Extensions: Size is before first semicolon if present
+		line := data[f.next:lineEnd]
+		if semi := bytes.IndexByte(line, ';'); semi != -1 {
+			line = line[:semi]
+		}
+
+		// Trim spaces (though RFC says no spaces allowed before size)
+		line = bytes.TrimSpace(line)
+
+		chunkSize, err := parseHexInt(line)
+		if err != nil {
+			// Malformed chunk size
+			return CheckResult{Error: err, Complete: false}
+		}
+
+		// Move past CRLF
+		f.next = lineEnd + 2
+		f.scanned = f.next
+
+		if chunkSize == 0 {
+			f.trailer = true
+			continue
+		}
+
+		// Skip Chunk Data + CRLF
+		if chunkSize > int64(maxInt-2-f.next) {
+			return CheckResult{Complete: false, Error: strconv.ErrRange}
+		}
+		if f.bodyLimit > 0 {
+			if chunkSize > f.bodyLimit-f.bodySize {
+				return CheckResult{HeaderLength: f.headerLen, Error: ErrBodyTooLarge}
+			}
+			f.bodySize += chunkSize
+		}
+		f.chunkEnd = f.next + int(chunkSize) + 2
+	}
+}
+
+// scanHeader looks for the end of the header block and scans the header fields that
+// decide the framing, recording them in f. It reports false with the result to return
+// while the header block is incomplete or invalid.
+func (c *Config) scanHeader(f *Framing, data []byte) (CheckResult, bool) {
+	maxSize := c.HeaderSizeLimit()
+
 	// 1. 헤더 경계 검색
-	headerEndIdx := bytes.Index(data, headerEnd)
+	from := max(f.scanned-len(headerEnd)+1, 0)
+	headerEndIdx := -1
+	if from <= len(data) {
+		if idx := bytes.Index(data[from:], headerEnd); idx != -1 {
+			headerEndIdx = from + idx
+		}
+	}
 	if headerEndIdx == -1 {
+		f.scanned = max(f.scanned, len(data))
 		// DoS Protection: If data exceeds limit and header end not found, reject.
-		if len(data) > MaxHeaderSize {
+		if len(data) > maxSize {
 			return CheckResult{
 				Complete: false,
-				Error:    strconv.ErrRange, // Or a custom error
-			}
+				Error:    ErrHeaderTooLarge,
+			}, false
+		}
+		// Lines seen so far already exceed the count (the request line is not a header).
+		if c.MaxHeaderCount > 0 && bytes.Count(data, crlf) > c.MaxHeaderCount+1 {
+			return CheckResult{Complete: false, Error: ErrTooManyHeaders}, false
 		}
-		return CheckResult{Complete: false}
+		// Headers ending in bare LFs would otherwise be waited on until the size limit.
+		if c.Strict && hasBareLF(data) {
+			return CheckResult{Complete: false, Error: ErrBareLF}, false
+		}
+		return CheckResult{Complete: false}, false
 	}
 
 	// DoS Protection: If header is found but too large
-	if headerEndIdx > MaxHeaderSize {
+	if headerEndIdx > maxSize {
 		return CheckResult{
 			Complete: false,
-			Error:    strconv.ErrRange,
-		}
+			Error:    ErrHeaderTooLarge,
+		}, false
 	}
 
 	headerBodySep := headerEndIdx + 4
 	headers := data[:headerEndIdx]
+	if c.Strict && hasBareLF(headers) {
+		return CheckResult{Complete: false, Error: ErrBareLF}, false
+	}
 
 	contentLength := -1
 	isChunked := false
+	expectContinue := false
+	hasTE := false
 
 	// 2. 주요 헤더 스캔 (Content-Length / Transfer-Encoding)
 	// Zero-Alloc Iterator: Scan headers line by line
 	// headers slice contains everything up to \r\n\r\n
-
 	// Skip Request Line (First line)
-	cur := headers
+	cur, requestLine := headers, headers
 	if idx := bytes.Index(cur, []byte("\r\n")); idx != -1 {
-		cur = cur[idx+2:]
+		cur, requestLine = cur[idx+2:], cur[:idx]
 	} else {
-		// No CRLF in headers? Should not happen if headerEndIdx was found
-		return CheckResult{Complete: false}
+		// Request line only, without any header fields.
+		cur = nil
 	}
 
+	headerCount := 0
 	for len(cur) > 0 {
+		if headerCount++; c.MaxHeaderCount > 0 && headerCount > c.MaxHeaderCount {
+			return CheckResult{Complete: false, Error: ErrTooManyHeaders}, false
+		}
+
 		var line []byte
 		idx := bytes.Index(cur, []byte("\r\n"))
 		if idx != -1 {
@@ -76,6 +311,10 @@ func CheckRequest(data []byte) CheckResult {
 			cur = nil
 		}
 
+		if c.Strict && (line[0] == ' ' || line[0] == '\t') {
+			return CheckResult{Complete: false, Error: ErrObsFold}, false
+		}
+
 		// Check for Content-Length
 		if len(line) > len(headerCL) && bytes.EqualFold(line[:len(headerCL)], headerCL) {
 			// Parse value: Trim spaces
@@ -83,19 +322,37 @@ func CheckRequest(data []byte) CheckResult {
 			val = bytes.TrimSpace(val)
 			cl, err := parseInt(val)
 			if err != nil {
-				return CheckResult{Complete: false, Error: err}
+				return CheckResult{Complete: false, Error: err}, false
 			}
 			if cl < 0 {
-				return CheckResult{Complete: false, Error: strconv.ErrSyntax}
+				return CheckResult{Complete: false, Error: strconv.ErrSyntax}, false
+			}
+			if c.Strict && contentLength >= 0 {
+				return CheckResult{Complete: false, Error: ErrDuplicateContentLength}, false
 			}
 			contentLength = cl
 			continue
 		}
 
+		// Check for Expect: 100-continue
+		if len(line) > len(headerExp) && bytes.EqualFold(line[:len(headerExp)], headerExp) {
+			expectContinue = bytes.EqualFold(bytes.TrimSpace(line[len(headerExp):]), val100)
+			continue
+		}
+
 		// Check for Transfer-Encoding
 		if len(line) > len(headerTE) && bytes.EqualFold(line[:len(headerTE)], headerTE) {
 			val := line[len(headerTE):]
 			val = bytes.TrimSpace(val)
+			if c.Strict {
+				// Only the final coding of the last field line decides the framing.
+				hasTE = true
+				if comma := bytes.LastIndexByte(val, ','); comma != -1 {
+					val = bytes.TrimSpace(val[comma+1:])
+				}
+				isChunked = bytes.EqualFold(val, valChunked)
+				continue
+			}
 			// Optimized: Check if contains "chunked" (case-insensitive) without allocation
 			// bytes.ToLower allocates.
 			// Simple implementation: "chunked" is 7 chars.
@@ -114,75 +371,44 @@ func CheckRequest(data []byte) CheckResult {
 		}
 	}
 
-	// 3. 바디 완성 여부 판단
-	if isChunked {
-		bodyData := data[headerBodySep:]
-		offset := 0
-
-		for {
-			// Find CRLF at end of chunk size line
-			idx := bytes.Index(bodyData[offset:], []byte("\r\n"))
-			if idx == -1 {
-				return CheckResult{Complete: false}
-			}
-
-			// Parse Chunk Size (hex)
-			// Handle Chunk Extensions: Size is before first semicolon if present
-			line := bodyData[offset : offset+idx]
-			if semi := bytes.IndexByte(line, ';'); semi != -1 {
-				line = line[:semi]
-			}
-
-			// Trim spaces (though RFC says no spaces allowed before size)
-			line = bytes.TrimSpace(line)
-
-			chunkSize, err := parseHexInt(line)
-			if err != nil {
-				// Malformed chunk size
-				return CheckResult{Error: err, Complete: false}
-			}
-
-			// Move past CRLF
-			offset += idx + 2
-
-			if chunkSize == 0 {
-				// Last chunk found. If there are no trailers, the next bytes are just CRLF.
-				if len(bodyData[offset:]) >= 2 && bytes.HasPrefix(bodyData[offset:], []byte("\r\n")) {
-					totalConsumed := headerBodySep + offset + 2
-					return CheckResult{Complete: true, BytesConsumed: totalConsumed}
-				}
-
-				// Otherwise, trailer section ends with CRLFCRLF.
-				trailerEnd := bytes.Index(bodyData[offset:], headerEnd)
-				if trailerEnd == -1 {
-					return CheckResult{Complete: false}
-				}
-
-				totalConsumed := headerBodySep + offset + trailerEnd + len(headerEnd)
-				return CheckResult{Complete: true, BytesConsumed: totalConsumed}
-			}
-
-			// Skip Chunk Data + CRLF
-			if chunkSize > maxInt64-2 || chunkSize > int64(maxInt-2) {
-				return CheckResult{Complete: false, Error: strconv.ErrRange}
-			}
-			if int64(len(bodyData[offset:])) < chunkSize+2 {
-				return CheckResult{Complete: false}
-			}
-			offset += int(chunkSize) + 2
+	if hasTE {
+		if contentLength >= 0 {
+			return CheckResult{Complete: false, Error: ErrContentLengthWithTE}, false
+		}
+		if !isChunked {
+			return CheckResult{Complete: false, Error: ErrChunkedNotFinal}, false
 		}
 	}
 
-	if contentLength >= 0 {
-		totalLen := headerBodySep + contentLength
-		if len(data) >= totalLen {
-			return CheckResult{Complete: true, BytesConsumed: totalLen}
-		}
-		return CheckResult{Complete: false}
+	// Reject a declared body over the limit before waiting for it to arrive.
+	bodyLimit := c.bodyLimit(requestLine)
+	if bodyLimit > 0 && !isChunked && int64(contentLength) > bodyLimit {
+		return CheckResult{HeaderLength: headerBodySep, Error: ErrBodyTooLarge}, false
 	}
 
-	// 바디가 없는 요청 (GET, HEAD 등)
-	return CheckResult{Complete: true, BytesConsumed: headerBodySep}
+	f.headerLen = headerBodySep
+	f.length = int64(contentLength)
+	f.chunked = isChunked
+	f.expect = expectContinue
+	f.next = headerBodySep
+	f.scanned = headerBodySep
+	f.bodyLimit = bodyLimit
+	return CheckResult{}, true
+}
+
+// bodyLimit returns the body size limit for the request starting with requestLine.
+func (c *Config) bodyLimit(requestLine []byte) int64 {
+	if c.MaxBodySizeFor == nil {
+		return c.MaxBodySize
+	}
+	target := requestLine
+	if sp := bytes.IndexByte(target, ' '); sp != -1 {
+		target = target[sp+1:]
+	}
+	if sp := bytes.IndexByte(target, ' '); sp != -1 {
+		target = target[:sp]
+	}
+	return c.MaxBodySizeFor(target)
 }
 
 // parseInt parses a decimal integer from a byte slice (Zero-Alloc).
@@ -248,6 +474,21 @@ func parseHexInt(b []byte) (int64, error) {
 	return n, nil
 }
 
+// hasBareLF reports whether b contains an LF that is not preceded by CR.
+func hasBareLF(b []byte) bool {
+	for i := bytes.IndexByte(b, '\n'); i != -1; {
+		if i == 0 || b[i-1] != '\r' {
+			return true
+		}
+		next := bytes.IndexByte(b[i+1:], '\n')
+		if next == -1 {
+			return false
+		}
+		i += next + 1
+	}
+	return false
+}
+
 // containsCaseInsensitive checks if s contains substr (case-insensitive).
 // substr must be lower-case.
 func containsCaseInsensitive(s, substr []byte) bool {
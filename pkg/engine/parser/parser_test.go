@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -121,3 +123,174 @@ func TestCheckRequest_HugeContentLengthReturnsError(t *testing.T) {
 		t.Fatalf("expected huge content-length request to be incomplete")
 	}
 }
+
+func TestCheckRequest_HeaderLength(t *testing.T) {
+	head := "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\n"
+	if got := CheckRequest([]byte(head[:len(head)-2])).HeaderLength; got != 0 {
+		t.Errorf("Expected HeaderLength 0 before the blank line, got %d", got)
+	}
+	res := CheckRequest([]byte(head + "Hello"))
+	if res.Complete || res.HeaderLength != len(head) {
+		t.Errorf("Expected incomplete body with HeaderLength %d, got %+v", len(head), res)
+	}
+}
+
+func TestConfig_CheckRequest_Limits(t *testing.T) {
+	cfg := &Config{MaxHeaderSize: 64, MaxHeaderCount: 2}
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"within limits", "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\n\r\n", nil},
+		{"too many headers", "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", ErrTooManyHeaders},
+		{"too many headers before the end", "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n", ErrTooManyHeaders},
+		{"header too large", "GET / HTTP/1.1\r\nA: " + strings.Repeat("a", 64) + "\r\n\r\n", ErrHeaderTooLarge},
+		{"incomplete header too large", "GET / HTTP/1.1\r\nA: " + strings.Repeat("a", 64), ErrHeaderTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.CheckRequest([]byte(tt.data)).Error; got != tt.err {
+				t.Errorf("Error = %v, want %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestConfig_CheckRequest_MaxBodySize(t *testing.T) {
+	cfg := &Config{MaxBodySize: 10}
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"content length at limit", "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\n", nil},
+		{"content length over limit", "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\n", ErrBodyTooLarge},
+		{"chunks at limit", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n", nil},
+		{"chunks over limit", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n", ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.CheckRequest([]byte(tt.data)).Error; got != tt.err {
+				t.Errorf("Error = %v, want %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestConfig_CheckRequest_MaxBodySizeFor(t *testing.T) {
+	cfg := &Config{MaxBodySize: 10, MaxBodySizeFor: func(target []byte) int64 {
+		if bytes.HasPrefix(target, []byte("/upload")) {
+			return 20
+		}
+		return 10
+	}}
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"raised content length", "POST /upload?x=1 HTTP/1.1\r\nContent-Length: 20\r\n\r\n", nil},
+		{"raised content length over limit", "POST /upload HTTP/1.1\r\nContent-Length: 21\r\n\r\n", ErrBodyTooLarge},
+		{"other route", "POST /other HTTP/1.1\r\nContent-Length: 11\r\n\r\n", ErrBodyTooLarge},
+		{"raised chunks", "POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nf\r\n0123456789abcde\r\n0\r\n\r\n", nil},
+		{"other route chunks", "POST /other HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nf\r\n", ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.CheckRequest([]byte(tt.data)).Error; got != tt.err {
+				t.Errorf("Error = %v, want %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckRequest_ExpectContinue(t *testing.T) {
+	head := "POST / HTTP/1.1\r\nContent-Length: 5\r\nExpect: 100-Continue\r\n\r\n"
+	if !CheckRequest([]byte(head)).ExpectContinue {
+		t.Error("Expected ExpectContinue while the body is pending")
+	}
+	if res := CheckRequest([]byte(head + "hello")); !res.Complete || res.ExpectContinue {
+		t.Errorf("Expected a complete request without ExpectContinue, got %+v", res)
+	}
+}
+
+func TestConfig_CheckRequest_Strict(t *testing.T) {
+	strict := &Config{Strict: true}
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"plain", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello", nil},
+		{"chunked", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", nil},
+		{"request line only", "GET / HTTP/1.0\r\n\r\n", nil},
+		{"content length with te", "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrContentLengthWithTE},
+		{"duplicate content length", "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello", ErrDuplicateContentLength},
+		{"differing content length", "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 0\r\n\r\nhello", ErrDuplicateContentLength},
+		{"chunked not final", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, gzip\r\n\r\n0\r\n\r\n", ErrChunkedNotFinal},
+		{"chunked overridden", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n\r\n", ErrChunkedNotFinal},
+		{"chunked substring", "POST / HTTP/1.1\r\nTransfer-Encoding: xchunked\r\n\r\n", ErrChunkedNotFinal},
+		{"obs fold", "GET / HTTP/1.1\r\nHost: x\r\n Transfer-Encoding: chunked\r\n\r\n", ErrObsFold},
+		{"bare lf", "GET / HTTP/1.1\nHost: x\r\n\r\n", ErrBareLF},
+		{"bare lf incomplete", "GET / HTTP/1.1\nHost: x\n", ErrBareLF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strict.CheckRequest([]byte(tt.data)).Error; got != tt.err {
+				t.Errorf("Error = %v, want %v", got, tt.err)
+			}
+		})
+	}
+
+	// The default mode keeps accepting what it always has.
+	lax := "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"
+	if res := CheckRequest([]byte(lax)); res.Error != nil || !res.Complete {
+		t.Errorf("Expected the default mode to accept %q, got %+v", lax, res)
+	}
+}
+
+func TestConfig_Resume_MatchesCheckRequest(t *testing.T) {
+	cfg := &Config{MaxBodySize: 64}
+	requests := []string{
+		"GET / HTTP/1.1\r\nHost: x\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\nhello",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n10\r\n0123456789abcdef\r\n0\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\nX-Sum: 1\r\nX-Other: 2\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\nzz\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n40\r\n" + strings.Repeat("a", 64) + "\r\n1\r\n",
+	}
+	for _, data := range requests {
+		var f Framing
+		for i := 0; i <= len(data); i++ {
+			got := cfg.Resume(&f, []byte(data[:i]))
+			want := cfg.CheckRequest([]byte(data[:i]))
+			if got != want {
+				t.Fatalf("%q at %d bytes: Resume = %+v, CheckRequest = %+v", data, i, got, want)
+			}
+			if got.Complete || got.Error != nil {
+				break
+			}
+		}
+	}
+}
+
+func TestConfig_Resume_ShorterData(t *testing.T) {
+	data := []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	var f Framing
+	if res := CheckRequest(data[:60]); res.Complete {
+		t.Fatal("expected a partial request")
+	}
+	defaultConfig.Resume(&f, data[:60])
+	if res := defaultConfig.Resume(&f, data[:10]); res.Complete || res.Error != nil {
+		t.Errorf("expected a shorter peek to be incomplete, got %+v", res)
+	}
+	if res := defaultConfig.Resume(&f, data); !res.Complete || res.BytesConsumed != len(data) {
+		t.Errorf("expected the request to complete, got %+v", res)
+	}
+
+	f.Reset()
+	if res := defaultConfig.Resume(&f, []byte("GET / HTTP/1.1\r\n\r\n")); !res.Complete {
+		t.Errorf("expected a reset Framing to start a new request, got %+v", res)
+	}
+}
@@ -0,0 +1,490 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrIncomplete is returned by ParseRequest when data does not hold the whole header block.
+	ErrIncomplete = errors.New("parser: incomplete request header")
+	// ErrUnsupported is returned by ParseRequest for requests it leaves to http.ReadRequest:
+	// versions other than HTTP/1.0 and 1.1, obs-folded or bare-LF lines, header names
+	// with spaces, repeated Content-Length, Host or Transfer-Encoding fields and
+	// declared trailers. Callers fall back to the net/http parser for them.
+	ErrUnsupported = errors.New("parser: request needs the net/http parser")
+
+	errMalformedRequest = errors.New("parser: malformed HTTP request")
+	errInvalidMethod    = errors.New("parser: invalid method")
+	errMalformedVersion = errors.New("parser: malformed HTTP version")
+	errMalformedHeader  = errors.New("parser: malformed MIME header line")
+	errBadContentLength = errors.New("parser: bad Content-Length")
+	errUnsupportedTE    = errors.New("parser: unsupported transfer encoding")
+	errMalformedChunk   = errors.New("parser: malformed chunked encoding")
+	errLongTrailer      = errors.New("parser: trailer section too long")
+)
+
+// Request is a reusable http.Request filled by ParseRequest. It keeps the header map,
+// URL and body reader between requests, so parsing a request allocates nothing but a
+// single string holding the header block, which the request's strings point into.
+// The embedded request must not be used once the Request is parsed into again.
+// Request는 ParseRequest가 채우는 재사용 가능한 http.Request입니다.
+type Request struct {
+	http.Request
+	url    url.URL
+	header http.Header
+	values []string
+	te     [1]string // Backs TransferEncoding.
+	body   requestBody
+}
+
+// ParseRequest parses the request line and header block at the start of data into r,
+// applying the same rules as http.ReadRequest (URL parsing, Host, Connection and
+// Content-Length/Transfer-Encoding framing), and returns the header block length.
+// The body is attached separately with SetBody. It returns ErrIncomplete if the
+// header block has not fully arrived and ErrUnsupported for requests it cannot parse
+// exactly like net/http; any other error means the request is malformed.
+// ParseRequest는 data의 요청 줄과 헤더를 한 번의 스캔으로 r에 파싱합니다.
+func ParseRequest(data []byte, r *Request) (int, error) {
+	end := bytes.Index(data, headerEnd)
+	if end == -1 {
+		return 0, ErrIncomplete
+	}
+	if hasBareLF(data[:end]) {
+		return 0, ErrUnsupported
+	}
+	n := end + len(headerEnd)
+	block := string(data[:end+len(crlf)])
+
+	// Request line: method SP request-target SP HTTP-version
+	lineEnd := strings.Index(block, "\r\n")
+	method, rest, ok1 := strings.Cut(block[:lineEnd], " ")
+	target, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return 0, errMalformedRequest
+	}
+	if !isToken(method) {
+		return 0, errInvalidMethod
+	}
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		return 0, errMalformedVersion
+	}
+	if major != 1 || minor > 1 {
+		return 0, ErrUnsupported
+	}
+
+	if r.header == nil {
+		r.header = make(http.Header)
+	} else {
+		clear(r.header)
+	}
+	r.values = r.values[:0]
+	r.url = url.URL{}
+	r.Request = http.Request{
+		Method:     method,
+		URL:        &r.url,
+		Proto:      proto,
+		ProtoMajor: 1,
+		ProtoMinor: minor,
+		Header:     r.header,
+		RequestURI: target,
+	}
+	if err := r.parseTarget(method, target); err != nil {
+		return 0, err
+	}
+
+	for cur := block[lineEnd+len(crlf):]; cur != ""; {
+		i := strings.Index(cur, "\r\n")
+		line := cur[:i]
+		cur = cur[i+len(crlf):]
+		if line[0] == ' ' || line[0] == '\t' {
+			return 0, ErrUnsupported
+		}
+		if err := r.addHeader(line); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := r.fixFraming(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// parseTarget fills r.URL from the request target, parsing plain origin-form paths
+// in place and leaving everything else to url.ParseRequestURI.
+func (r *Request) parseTarget(method, target string) error {
+	path, query, hasQuery := strings.Cut(target, "?")
+	if len(path) > 0 && path[0] == '/' && isPlainPath(path) && isPlainQuery(query) && !strings.Contains(query, "?") {
+		r.url.Path = path
+		r.url.RawQuery = query
+		r.url.ForceQuery = hasQuery && query == ""
+		return nil
+	}
+
+	// CONNECT targets are usually an authority rather than a URL (see http.ReadRequest).
+	justAuthority := method == "CONNECT" && !strings.HasPrefix(target, "/")
+	if justAuthority {
+		target = "http://" + target
+	}
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return err
+	}
+	r.url = *u
+	if justAuthority {
+		r.url.Scheme = ""
+	}
+	return nil
+}
+
+// addHeader adds one "Key: value" field line to the header map.
+func (r *Request) addHeader(line string) error {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || key == "" {
+		return errMalformedHeader
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; !isTokenByte(c) {
+			if c == ' ' {
+				// net/http keeps such names as they are, without canonicalizing them.
+				return ErrUnsupported
+			}
+			return errMalformedHeader
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' && c != '\t' || c == 0x7f {
+			return errMalformedHeader
+		}
+	}
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	value = trimOWS(value)
+
+	vv, ok := r.header[key]
+	if !ok {
+		r.values = append(r.values, value)
+		n := len(r.values)
+		r.header[key] = r.values[n-1 : n : n]
+		return nil
+	}
+	switch key {
+	case "Host", "Content-Length", "Transfer-Encoding":
+		return ErrUnsupported
+	}
+	r.header[key] = append(vv, value)
+	return nil
+}
+
+// fixFraming applies net/http's post-processing of request headers: Host, the
+// Pragma/Cache-Control fixup, connection persistence and body framing.
+func (r *Request) fixFraming() error {
+	h := r.header
+	r.Host = r.url.Host
+	if v := h["Host"]; len(v) > 0 {
+		if r.Host == "" {
+			r.Host = v[0]
+		}
+		delete(h, "Host")
+	}
+
+	if p := h["Pragma"]; len(p) > 0 && p[0] == "no-cache" {
+		if _, ok := h["Cache-Control"]; !ok {
+			h["Cache-Control"] = []string{"no-cache"}
+		}
+	}
+
+	conn := h["Connection"]
+	r.Close = containsToken(conn, "close")
+	if r.ProtoMinor == 0 {
+		r.Close = r.Close || !containsToken(conn, "keep-alive")
+	}
+
+	chunked := false
+	if te, ok := h["Transfer-Encoding"]; ok {
+		delete(h, "Transfer-Encoding")
+		// Transfer-Encoding is ignored on HTTP/1.0 requests.
+		if r.ProtoMinor == 1 {
+			if !asciiEqualFold(te[0], "chunked") {
+				return errUnsupportedTE
+			}
+			chunked = true
+		}
+	}
+
+	if cl, ok := h["Content-Length"]; ok {
+		n, err := strconv.ParseUint(cl[0], 10, 63)
+		if err != nil {
+			return errBadContentLength
+		}
+		r.ContentLength = int64(n)
+	}
+	if chunked {
+		delete(h, "Content-Length")
+		if _, ok := h["Trailer"]; ok {
+			return ErrUnsupported
+		}
+		r.ContentLength = -1
+		r.te[0] = "chunked"
+		r.TransferEncoding = r.te[:]
+	}
+	return nil
+}
+
+// Reset drops everything r refers to from the last request while keeping its storage.
+// Reset은 저장 공간은 유지한 채 마지막 요청에 대한 참조를 모두 해제합니다.
+func (r *Request) Reset() {
+	r.Request = http.Request{}
+	r.url = url.URL{}
+	clear(r.header)
+	clear(r.values)
+	r.values = r.values[:0]
+	r.body = requestBody{}
+}
+
+// SetBody attaches the request body, read from br, according to the framing found by
+// ParseRequest. br must be positioned right after the header block.
+// SetBody는 ParseRequest가 결정한 프레이밍에 따라 br에서 읽는 요청 본문을 설정합니다.
+func (r *Request) SetBody(br *bufio.Reader) {
+	switch {
+	case r.ContentLength == 0:
+		r.Body = http.NoBody
+	case r.ContentLength > 0:
+		r.body = requestBody{r: br, remaining: r.ContentLength}
+		r.Body = &r.body
+	default:
+		r.body = requestBody{r: br, chunked: true, req: &r.Request}
+		r.Body = &r.body
+	}
+}
+
+// requestBody reads a Content-Length or chunked request body from the connection.
+// Close does not drain what is left; the engine decides whether to.
+type requestBody struct {
+	r         *bufio.Reader
+	remaining int64 // Bytes left in the body, or in the current chunk.
+	chunked   bool
+	req       *http.Request // Receives trailers.
+	closed    bool
+	err       error // Sticky once the body is done.
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.remaining == 0 && b.chunked {
+		if b.err = b.nextChunk(); b.err != nil {
+			return 0, b.err
+		}
+	}
+	if b.remaining == 0 {
+		b.err = io.EOF
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.err = err
+		return n, err
+	}
+	if b.remaining == 0 && b.chunked {
+		// Consume the CRLF after the chunk data.
+		if crlf, err := b.r.Peek(2); err != nil || crlf[0] != '\r' || crlf[1] != '\n' {
+			b.err = chunkError(err)
+			return n, b.err
+		}
+		_, _ = b.r.Discard(2)
+	}
+	return n, nil
+}
+
+// nextChunk reads the next chunk-size line. The last chunk sets b.remaining to zero
+// and returns io.EOF once the trailer section has been consumed.
+func (b *requestBody) nextChunk() error {
+	line, err := b.r.ReadSlice('\n')
+	if err != nil {
+		return chunkError(err)
+	}
+	// The line must end in CRLF, with no other CR in it.
+	if len(line) < 2 || bytes.IndexByte(line, '\r') != len(line)-2 {
+		return errMalformedChunk
+	}
+	line = line[:len(line)-2]
+	if semi := bytes.IndexByte(line, ';'); semi != -1 {
+		line = line[:semi]
+	}
+	size, err := parseHexInt(bytes.TrimRight(line, " \t"))
+	if err != nil {
+		return errMalformedChunk
+	}
+	if size == 0 {
+		return b.readTrailer()
+	}
+	b.remaining = size
+	return nil
+}
+
+// readTrailer consumes the trailer section after the last chunk, exposing any
+// fields as req.Trailer like net/http does.
+func (b *requestBody) readTrailer() error {
+	end, err := b.r.Peek(2)
+	if len(end) == 2 && end[0] == '\r' && end[1] == '\n' {
+		_, _ = b.r.Discard(2)
+		return io.EOF
+	}
+	if err != nil {
+		return chunkError(err)
+	}
+	// Only read trailers that are entirely buffered, so they cannot grow unbounded.
+	if !bufferedHeaderEnd(b.r) {
+		return errLongTrailer
+	}
+	hdr, err := textproto.NewReader(b.r).ReadMIMEHeader()
+	if err != nil {
+		return chunkError(err)
+	}
+	if b.req.Trailer == nil {
+		b.req.Trailer = http.Header(hdr)
+	} else {
+		for k, vv := range hdr {
+			b.req.Trailer[k] = vv
+		}
+	}
+	return io.EOF
+}
+
+func (b *requestBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// bufferedHeaderEnd reports whether a blank line ends the header section buffered in r,
+// filling r's buffer as needed.
+func bufferedHeaderEnd(r *bufio.Reader) bool {
+	for n := len(headerEnd); ; n++ {
+		buf, err := r.Peek(n)
+		if bytes.HasSuffix(buf, headerEnd) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+func chunkError(err error) error {
+	if err == nil {
+		return errMalformedChunk
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// isTokenByte reports whether c may appear in a method or header field name (RFC 9110 token).
+func isTokenByte(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPlainPath reports whether path is stored verbatim in url.URL.Path, i.e. it has
+// no escapes and no bytes url.URL would escape.
+func isPlainPath(path string) bool {
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-_.~$&+,/:;=@", c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isPlainQuery reports whether query has no control bytes, which url.URL rejects.
+func isPlainQuery(query string) bool {
+	for i := 0; i < len(query); i++ {
+		if c := query[i]; c < ' ' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func trimOWS(s string) string {
+	for len(s) > 0 && (s[0] == ' ' || s[0] == '\t') {
+		s = s[1:]
+	}
+	for len(s) > 0 && (s[len(s)-1] == ' ' || s[len(s)-1] == '\t') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// containsToken reports whether any comma-separated element of values is token,
+// compared ASCII case-insensitively.
+func containsToken(values []string, token string) bool {
+	for _, v := range values {
+		for v != "" {
+			var elem string
+			elem, v, _ = strings.Cut(v, ",")
+			if asciiEqualFold(trimOWS(elem), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func asciiEqualFold(s, t string) bool {
+	if len(s) != len(t) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		a, b := s[i], t[i]
+		if 'A' <= a && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
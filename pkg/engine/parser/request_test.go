@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// differentialRequests are parsed by both ParseRequest and http.ReadRequest. The
+// native ones must be handled by ParseRequest without falling back.
+var differentialRequests = []struct {
+	data   string
+	native bool
+}{
+	{"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", true},
+	{"GET /a/b;c=d/e.html?x=1&y=%20z HTTP/1.1\r\nHost: x\r\nUser-Agent: t\r\nAccept: */*\r\n\r\n", true},
+	{"GET /a? HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET /a?b?c HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET /a?b#frag HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET //double/slash HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET /%7Euser/a%2Fb HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET /caf\xc3\xa9 HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET /a%zz HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"GET http://example.com:8080/p?q HTTP/1.1\r\nHost: ignored\r\n\r\n", true},
+	{"OPTIONS * HTTP/1.1\r\nHost: x\r\n\r\n", true},
+	{"CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n", true},
+	{"CONNECT /rpc HTTP/1.1\r\n\r\n", true},
+	{"GET / HTTP/1.0\r\n\r\n", true},
+	{"GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nConnection: upgrade, CLOSE\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nconnection: keep-alive\r\nx-lower-case: v\r\nX-MiXeD-case: v\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nX-Empty:\r\nX-Spaces:   padded \t \r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nAccept: a\r\nAccept: b\r\nAccept: c\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nX-Obs-Text: caf\xc3\xa9\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nPragma: no-cache\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nPragma: no-cache\r\nCache-Control: max-age=0\r\n\r\n", true},
+	{"POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello", true},
+	{"POST / HTTP/1.1\r\nContent-Length: 0\r\n\r\n", true},
+	{"POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nshort", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\n\r\n", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\nContent-Length: 3\r\n\r\n3\r\nabc\r\n0\r\nX-Checksum: 1\r\n\r\n", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloXX0\r\n\r\n", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n\n", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\n", true},
+	{"POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\nContent-Length: 2\r\n\r\nhi", true},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", true},
+	{"POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", true},
+	{"POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello", true},
+	{"POST / HTTP/1.1\r\nContent-Length:\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nBad\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\n: no-name\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nBad\"Name: v\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nX: a\x00b\r\n\r\n", true},
+	{"GET / HTTP/1.1\r\nX: a\rb\r\n\r\n", true},
+	{"G(T / HTTP/1.1\r\n\r\n", true},
+	{"GET /\r\n\r\n", true},
+	{"GET\r\n\r\n", true},
+	{"\r\n\r\n", true},
+	{"GET a HTTP/1.1\r\n\r\n", true},
+	{"GET /a\x01b HTTP/1.1\r\n\r\n", true},
+	{"GET / extra HTTP/1.1\r\n\r\n", true},
+
+	// Left to net/http.
+	{"GET / HTTP/1.2\r\n\r\n", false},
+	{"GET / HTTP/2.0\r\n\r\n", false},
+	{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", false},
+	{"GET / HTTP/1.1\r\nX: a\r\n  folded\r\n\r\n", false},
+	{"GET / HTTP/1.1\nHost: x\r\n\r\n", false},
+	{"GET / HTTP/1.1\r\nBad Name: v\r\n\r\n", false},
+	{"GET / HTTP/1.1\r\nHost: a\r\nHost: b\r\n\r\n", false},
+	{"POST / HTTP/1.1\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nhi", false},
+	{"POST / HTTP/1.1\r\nContent-Length: 2\r\nContent-Length: 3\r\n\r\nhi", false},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", false},
+	{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n0\r\nX-Sum: 1\r\n\r\n", false},
+	{"GET / HTTP/1.1\r\nHost: x\r\n", false},
+}
+
+func TestParseRequest_MatchesReadRequest(t *testing.T) {
+	for _, tt := range differentialRequests {
+		err := compareWithReadRequest(t, tt.data)
+		if tt.native && err != nil {
+			t.Errorf("%q: expected native parsing, got %v", tt.data, err)
+		}
+		if !tt.native && err == nil {
+			t.Errorf("%q: expected a fallback to net/http", tt.data)
+		}
+	}
+}
+
+func FuzzParseRequest(f *testing.F) {
+	for _, tt := range differentialRequests {
+		f.Add(tt.data)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		compareWithReadRequest(t, data)
+	})
+}
+
+// compareWithReadRequest checks that ParseRequest and http.ReadRequest agree on data,
+// returning ParseRequest's error if it declined to parse it.
+func compareWithReadRequest(t *testing.T, data string) error {
+	t.Helper()
+	var r Request
+	n, err := ParseRequest([]byte(data), &r)
+	if err == ErrIncomplete || err == ErrUnsupported {
+		return err
+	}
+
+	want, wantErr := http.ReadRequest(bufio.NewReader(strings.NewReader(data)))
+	if (err != nil) != (wantErr != nil) {
+		t.Fatalf("%q: ParseRequest error %v, http.ReadRequest error %v", data, err, wantErr)
+	}
+	if err != nil {
+		return nil
+	}
+
+	got := &r.Request
+	checks := []struct {
+		field     string
+		got, want any
+	}{
+		{"Method", got.Method, want.Method},
+		{"RequestURI", got.RequestURI, want.RequestURI},
+		{"URL", *got.URL, *want.URL},
+		{"Proto", got.Proto, want.Proto},
+		{"ProtoMajor", got.ProtoMajor, want.ProtoMajor},
+		{"ProtoMinor", got.ProtoMinor, want.ProtoMinor},
+		{"Header", got.Header, want.Header},
+		{"Host", got.Host, want.Host},
+		{"ContentLength", got.ContentLength, want.ContentLength},
+		{"TransferEncoding", got.TransferEncoding, want.TransferEncoding},
+		{"Close", got.Close, want.Close},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%q: %s = %#v, want %#v", data, c.field, c.got, c.want)
+		}
+	}
+
+	br := bufio.NewReader(strings.NewReader(data))
+	_, _ = br.Discard(n)
+	r.SetBody(br)
+	gotBody, gotErr := io.ReadAll(got.Body)
+	wantBody, wantErr := io.ReadAll(want.Body)
+	if string(gotBody) != string(wantBody) || (gotErr != nil) != (wantErr != nil) {
+		t.Errorf("%q: body %q (%v), want %q (%v)", data, gotBody, gotErr, wantBody, wantErr)
+	}
+	if !reflect.DeepEqual(got.Trailer, want.Trailer) {
+		t.Errorf("%q: Trailer = %#v, want %#v", data, got.Trailer, want.Trailer)
+	}
+	return nil
+}
+
+func TestRequest_Reuse(t *testing.T) {
+	var r Request
+	first := "POST /a HTTP/1.1\r\nHost: x\r\nX-Old: 1\r\nTransfer-Encoding: chunked\r\n\r\n"
+	if _, err := ParseRequest([]byte(first), &r); err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	second := "GET /b?q HTTP/1.1\r\nHost: y\r\n\r\n"
+	if _, err := ParseRequest([]byte(second), &r); err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if r.Method != "GET" || r.URL.Path != "/b" || r.URL.RawQuery != "q" || r.Host != "y" {
+		t.Errorf("unexpected request %s %s host %s", r.Method, r.URL, r.Host)
+	}
+	if len(r.Header) != 0 || r.TransferEncoding != nil || r.ContentLength != 0 {
+		t.Errorf("state leaked from the previous request: header %v, te %v, cl %d", r.Header, r.TransferEncoding, r.ContentLength)
+	}
+
+	r.SetBody(bufio.NewReader(strings.NewReader("")))
+	if r.Body != http.NoBody {
+		t.Errorf("expected http.NoBody, got %T", r.Body)
+	}
+}
+
+func TestRequest_BodyReadAfterClose(t *testing.T) {
+	var r Request
+	data := "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"
+	n, err := ParseRequest([]byte(data), &r)
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	br := bufio.NewReader(strings.NewReader(data[n:]))
+	r.SetBody(br)
+	r.Body.Close()
+	if _, err := r.Body.Read(make([]byte, 1)); !errors.Is(err, http.ErrBodyReadAfterClose) {
+		t.Errorf("expected ErrBodyReadAfterClose, got %v", err)
+	}
+	// Close leaves the unread body to the caller.
+	if rest, _ := io.ReadAll(br); string(rest) != "hello" {
+		t.Errorf("expected the body to stay unread, got %q", rest)
+	}
+}
@@ -0,0 +1,80 @@
+package engine
+
+import "github.com/cloudwego/netpoll"
+
+// WithMaxPipelineDepth limits how many pipelined requests are served back to back from
+// data a client has already sent. Once n responses have been written while further
+// requests are still waiting, the connection is closed after the n-th response and the
+// client retries the rest on a new connection (RFC 9112 §9.3.2). Responses are always
+// written in request order. The default, 0, means no limit.
+// WithMaxPipelineDepth는 이미 수신된 파이프라인 요청을 연속으로 처리하는 최대 개수를 제한합니다.
+func WithMaxPipelineDepth(n int) Option {
+	return func(e *Engine) {
+		e.maxPipelineDepth = n
+	}
+}
+
+// WithBatchedFlush coalesces the responses to pipelined requests into as few writes as
+// possible: a completed response stays in the connection's write buffer while the next
+// request has already arrived, and the batch is flushed once no request is waiting or
+// the buffer fills up. A slow handler therefore delays the responses batched before it.
+// Responses to requests with a body are flushed before the body is drained.
+// WithBatchedFlush는 파이프라인 요청에 대한 응답들을 가능한 한 적은 쓰기로 묶어 전송합니다.
+func WithBatchedFlush(enabled bool) Option {
+	return func(e *Engine) {
+		e.batchFlush = enabled
+	}
+}
+
+// requestPending reports whether the client has already sent more data, which on a
+// connection between requests is the start of a pipelined request.
+func requestPending(conn netpoll.Connection, state *ConnectionState) bool {
+	if state.Reader.Buffered() > 0 {
+		return true
+	}
+	r := conn.Reader()
+	return r != nil && r.Len() > 0
+}
+
+// checkPipelined applies the header limits and framing checks to a request whose start
+// the previous request already pulled into the connection's read buffer, where the
+// reactor-side check never sees it. Headers that continue in the reactor's buffer are
+// checked together with it. It reports whether the request may be dispatched; when it
+// returns false the request was rejected or its headers have not fully arrived.
+// checkPipelined는 읽기 버퍼에 이미 들어온 파이프라인 요청에도 헤더 제한과 프레이밍 검사를 적용합니다.
+func (e *Engine) checkPipelined(conn netpoll.Connection, state *ConnectionState) bool {
+	data, _ := state.Reader.Peek(state.Reader.Buffered())
+	if shouldBypassFullRequestCheck(data, &e.parser) {
+		return true
+	}
+	check := e.parser.Resume(&state.framing, data)
+	if check.HeaderLength == 0 && check.Error == nil {
+		if r := conn.Reader(); r != nil && r.Len() > 0 {
+			more, _ := r.Peek(r.Len())
+			data = append(data[:len(data):len(data)], more...)
+			check = e.parser.Resume(&state.framing, data)
+		}
+	}
+	if check.Error != nil {
+		state.framing.Reset()
+		e.rejectRequest(conn, state, check.Error, data)
+		conn.Close()
+		return false
+	}
+	if check.HeaderLength == 0 {
+		e.armReadDeadline(conn, state, len(data), 0)
+		return false
+	}
+	// The body is read through the buffer as the handler asks for it.
+	if check.ExpectContinue && !state.continued {
+		if e.immediateContinue {
+			state.sendContinue()
+		} else {
+			state.expect.Store(true)
+		}
+	}
+	state.bodyLimit = state.framing.BodyLimit()
+	state.framing.Reset()
+	e.clearReadDeadline(state)
+	return true
+}
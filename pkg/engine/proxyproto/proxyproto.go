@@ -0,0 +1,267 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+)
+
+// Mode controls how PROXY protocol headers are handled on accepted connections.
+// Mode는 수락된 연결에서 PROXY 프로토콜 헤더를 처리하는 방식을 제어합니다.
+type Mode uint8
+
+const (
+	Off      Mode = iota // Headers are not parsed. // 헤더를 파싱하지 않습니다.
+	Optional             // A header is parsed if present. // 헤더가 있으면 파싱합니다.
+	Required             // Connections without a valid header are closed. // 유효한 헤더가 없으면 연결을 닫습니다.
+)
+
+// Command is the v2 command. v1 headers always report CommandProxy.
+type Command uint8
+
+const (
+	CommandLocal Command = 0x0 // Health check from the proxy itself; addresses are not meaningful.
+	CommandProxy Command = 0x1 // Relayed connection on behalf of another node.
+)
+
+// TLV types defined by the PROXY protocol v2 specification.
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02 // Host name sent by the client (typically the TLS SNI).
+	TypeCRC32C    byte = 0x03
+	TypeNoop      byte = 0x04
+	TypeUniqueID  byte = 0x05
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+)
+
+const (
+	v1MaxLen    = 107 // Longest possible v1 line, including CRLF.
+	v2HeaderLen = 16
+
+	// MaxHeaderLen is the longest possible header (v2 with a full-length payload).
+	MaxHeaderLen = v2HeaderLen + 0xffff
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	crlf        = []byte("\r\n")
+)
+
+var (
+	// ErrNoHeader is returned when data does not start with a PROXY protocol signature.
+	ErrNoHeader = errors.New("proxyproto: no PROXY protocol header")
+	// ErrInvalidHeader is returned for malformed headers.
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY protocol header")
+)
+
+// TLV is a type-length-value extension carried by a v2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header is a parsed PROXY protocol header.
+// Header는 파싱된 PROXY 프로토콜 헤더입니다.
+type Header struct {
+	Version     int      // 1 or 2.
+	Command     Command  // CommandLocal or CommandProxy.
+	Source      net.Addr // Original client address; nil for LOCAL or UNKNOWN.
+	Destination net.Addr // Original destination address; nil for LOCAL or UNKNOWN.
+	TLVs        []TLV    // v2 extensions, in wire order.
+}
+
+// TLV returns the value of the first extension of the given type.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, t := range h.TLVs {
+		if t.Type == typ {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Authority returns the PP2_TYPE_AUTHORITY value, i.e. the host name (SNI) the client asked for.
+func (h *Header) Authority() string {
+	v, _ := h.TLV(TypeAuthority)
+	return string(v)
+}
+
+// Parse parses a PROXY protocol header at the start of data.
+// It returns the header and the number of bytes it occupies. If data is a valid but
+// incomplete prefix, Parse returns (nil, 0, nil) and should be called again with more data.
+// ErrNoHeader is returned when data cannot start a PROXY header.
+// Parse는 data 시작 부분의 PROXY 프로토콜 헤더를 파싱합니다.
+// 데이터가 불완전하면 (nil, 0, nil)을 반환하며, 더 많은 데이터로 다시 호출해야 합니다.
+func Parse(data []byte) (*Header, int, error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+	switch data[0] {
+	case v1Prefix[0]:
+		if !hasPrefixPartial(data, v1Prefix) {
+			return nil, 0, ErrNoHeader
+		}
+		return parseV1(data)
+	case v2Signature[0]:
+		if !hasPrefixPartial(data, v2Signature) {
+			return nil, 0, ErrNoHeader
+		}
+		return parseV2(data)
+	}
+	return nil, 0, ErrNoHeader
+}
+
+// hasPrefixPartial reports whether data and prefix agree on their common length.
+func hasPrefixPartial(data, prefix []byte) bool {
+	n := min(len(data), len(prefix))
+	return bytes.Equal(data[:n], prefix[:n])
+}
+
+func parseV1(data []byte) (*Header, int, error) {
+	end := bytes.Index(data[:min(len(data), v1MaxLen)], crlf)
+	if end == -1 {
+		if len(data) >= v1MaxLen {
+			return nil, 0, ErrInvalidHeader
+		}
+		return nil, 0, nil
+	}
+	n := end + len(crlf)
+
+	fields := bytes.Split(data[len(v1Prefix):end], []byte(" "))
+	h := &Header{Version: 1, Command: CommandProxy}
+	switch string(fields[0]) {
+	case "UNKNOWN":
+		// Addresses (if any) must be ignored.
+		return h, n, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, 0, ErrInvalidHeader
+	}
+	if len(fields) != 5 {
+		return nil, 0, ErrInvalidHeader
+	}
+
+	srcIP, dstIP := net.ParseIP(string(fields[1])), net.ParseIP(string(fields[2]))
+	if srcIP == nil || dstIP == nil {
+		return nil, 0, ErrInvalidHeader
+	}
+	if is4 := string(fields[0]) == "TCP4"; is4 != (srcIP.To4() != nil) || is4 != (dstIP.To4() != nil) {
+		return nil, 0, ErrInvalidHeader
+	}
+	srcPort, err1 := parsePort(fields[3])
+	dstPort, err2 := parsePort(fields[4])
+	if err1 != nil || err2 != nil {
+		return nil, 0, ErrInvalidHeader
+	}
+
+	h.Source = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	h.Destination = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return h, n, nil
+}
+
+func parsePort(b []byte) (int, error) {
+	// Leading zeros are forbidden by the spec.
+	if len(b) == 0 || len(b) > 5 || (len(b) > 1 && b[0] == '0') {
+		return 0, strconv.ErrSyntax
+	}
+	p, err := strconv.Atoi(string(b))
+	if err != nil || p > 65535 {
+		return 0, strconv.ErrRange
+	}
+	return p, nil
+}
+
+func parseV2(data []byte) (*Header, int, error) {
+	if len(data) < v2HeaderLen {
+		return nil, 0, nil
+	}
+	verCmd, famProto := data[12], data[13]
+	if verCmd>>4 != 2 {
+		return nil, 0, ErrInvalidHeader
+	}
+	n := v2HeaderLen + int(binary.BigEndian.Uint16(data[14:16]))
+	if len(data) < n {
+		return nil, 0, nil
+	}
+	payload := data[v2HeaderLen:n]
+
+	h := &Header{Version: 2, Command: Command(verCmd & 0x0f)}
+	if h.Command != CommandLocal && h.Command != CommandProxy {
+		return nil, 0, ErrInvalidHeader
+	}
+
+	var addrLen int
+	switch famProto >> 4 {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen = 12
+	case 0x2: // AF_INET6
+		addrLen = 36
+	case 0x3: // AF_UNIX
+		addrLen = 216
+	default:
+		return nil, 0, ErrInvalidHeader
+	}
+	if len(payload) < addrLen {
+		return nil, 0, ErrInvalidHeader
+	}
+
+	if h.Command == CommandProxy {
+		h.Source, h.Destination = v2Addrs(famProto, payload[:addrLen])
+	}
+
+	if tlvs := payload[addrLen:]; len(tlvs) > 0 {
+		// Copy once so the header outlives the connection's input buffer.
+		tlvs = append([]byte(nil), tlvs...)
+		for len(tlvs) > 0 {
+			if len(tlvs) < 3 {
+				return nil, 0, ErrInvalidHeader
+			}
+			l := int(binary.BigEndian.Uint16(tlvs[1:3]))
+			if len(tlvs) < 3+l {
+				return nil, 0, ErrInvalidHeader
+			}
+			h.TLVs = append(h.TLVs, TLV{Type: tlvs[0], Value: tlvs[3 : 3+l : 3+l]})
+			tlvs = tlvs[3+l:]
+		}
+	}
+	return h, n, nil
+}
+
+func v2Addrs(famProto byte, b []byte) (src, dst net.Addr) {
+	stream := famProto&0x0f != 0x2
+	ipAddr := func(ip net.IP, port uint16) net.Addr {
+		if stream {
+			return &net.TCPAddr{IP: ip, Port: int(port)}
+		}
+		return &net.UDPAddr{IP: ip, Port: int(port)}
+	}
+
+	switch famProto >> 4 {
+	case 0x1:
+		return ipAddr(net.IP(append([]byte(nil), b[0:4]...)), binary.BigEndian.Uint16(b[8:10])),
+			ipAddr(net.IP(append([]byte(nil), b[4:8]...)), binary.BigEndian.Uint16(b[10:12]))
+	case 0x2:
+		return ipAddr(net.IP(append([]byte(nil), b[0:16]...)), binary.BigEndian.Uint16(b[32:34])),
+			ipAddr(net.IP(append([]byte(nil), b[16:32]...)), binary.BigEndian.Uint16(b[34:36]))
+	case 0x3:
+		network := "unix"
+		if !stream {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: cString(b[:108]), Net: network},
+			&net.UnixAddr{Name: cString(b[108:216]), Net: network}
+	}
+	return nil, nil
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
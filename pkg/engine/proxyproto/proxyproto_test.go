@@ -0,0 +1,112 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+)
+
+func buildV2(cmd byte, famProto byte, addrs []byte, tlvs ...TLV) []byte {
+	payload := append([]byte(nil), addrs...)
+	for _, t := range tlvs {
+		payload = append(payload, t.Type, byte(len(t.Value)>>8), byte(len(t.Value)))
+		payload = append(payload, t.Value...)
+	}
+	b := append([]byte(nil), v2Signature...)
+	b = append(b, 0x20|cmd, famProto, 0, 0)
+	binary.BigEndian.PutUint16(b[14:16], uint16(len(payload)))
+	return append(b, payload...)
+}
+
+func TestParse_V1(t *testing.T) {
+	data := []byte("PROXY TCP4 192.0.2.1 198.51.100.2 56324 443\r\nGET / HTTP/1.1\r\n")
+	h, n, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if string(data[n:]) != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("unexpected consumed length %d", n)
+	}
+	if h.Version != 1 || h.Source.String() != "192.0.2.1:56324" || h.Destination.String() != "198.51.100.2:443" {
+		t.Fatalf("unexpected header %+v", h)
+	}
+}
+
+func TestParse_V1Unknown(t *testing.T) {
+	h, n, err := Parse([]byte("PROXY UNKNOWN\r\n"))
+	if err != nil || n != 15 || h.Source != nil {
+		t.Fatalf("unexpected result h=%+v n=%d err=%v", h, n, err)
+	}
+}
+
+func TestParse_V2WithTLVs(t *testing.T) {
+	addrs := make([]byte, 12)
+	copy(addrs[0:4], net.IPv4(10, 0, 0, 1).To4())
+	copy(addrs[4:8], net.IPv4(10, 0, 0, 2).To4())
+	binary.BigEndian.PutUint16(addrs[8:10], 4000)
+	binary.BigEndian.PutUint16(addrs[10:12], 8443)
+	data := buildV2(0x1, 0x11, addrs, TLV{Type: TypeAuthority, Value: []byte("api.example.com")}, TLV{Type: TypeNoop})
+	data = append(data, "GET"...)
+
+	h, n, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if string(data[n:]) != "GET" {
+		t.Fatalf("unexpected consumed length %d", n)
+	}
+	if h.Version != 2 || h.Command != CommandProxy {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	if h.Source.String() != "10.0.0.1:4000" || h.Destination.String() != "10.0.0.2:8443" {
+		t.Fatalf("unexpected addresses %v -> %v", h.Source, h.Destination)
+	}
+	if got := h.Authority(); got != "api.example.com" {
+		t.Fatalf("Authority() = %q", got)
+	}
+	if len(h.TLVs) != 2 {
+		t.Fatalf("expected 2 TLVs, got %d", len(h.TLVs))
+	}
+}
+
+func TestParse_V2Local(t *testing.T) {
+	h, n, err := Parse(buildV2(0x0, 0x00, nil))
+	if err != nil || n != v2HeaderLen || h.Command != CommandLocal || h.Source != nil {
+		t.Fatalf("unexpected result h=%+v n=%d err=%v", h, n, err)
+	}
+}
+
+func TestParse_Incomplete(t *testing.T) {
+	full := []byte("PROXY TCP4 192.0.2.1 198.51.100.2 56324 443\r\n")
+	v2 := buildV2(0x1, 0x11, make([]byte, 12))
+	for _, data := range [][]byte{full[:3], full[:20], v2[:5], v2[:20]} {
+		if h, n, err := Parse(data); h != nil || n != 0 || err != nil {
+			t.Fatalf("Parse(%q) = %v, %d, %v; want need-more", data, h, n, err)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"plain http", []byte("GET / HTTP/1.1\r\n"), ErrNoHeader},
+		{"p but not proxy", []byte("POST / HTTP/1.1\r\n"), ErrNoHeader},
+		{"bad protocol", []byte("PROXY UDP4 1.1.1.1 2.2.2.2 1 2\r\n"), ErrInvalidHeader},
+		{"family mismatch", []byte("PROXY TCP4 ::1 ::1 1 2\r\n"), ErrInvalidHeader},
+		{"port leading zero", []byte("PROXY TCP4 1.1.1.1 2.2.2.2 01 2\r\n"), ErrInvalidHeader},
+		{"v1 too long", append([]byte("PROXY "), make([]byte, v1MaxLen)...), ErrInvalidHeader},
+		{"v2 short address", buildV2(0x1, 0x21, make([]byte, 12)), ErrInvalidHeader},
+		{"v2 truncated tlv", append(buildV2(0x1, 0x00, nil)[:14], 0, 2, TypeAuthority, 0), ErrInvalidHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Parse(tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Default histogram buckets, in the units reported by Histogram.Bounds.
+var (
+	// DurationBuckets are the request latency bucket bounds, in seconds.
+	DurationBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// SizeBuckets are the request size bucket bounds, in bytes.
+	SizeBuckets = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+)
+
+// Stats is a snapshot of the engine's request-level counters.
+// Stats는 엔진의 요청 단위 카운터 스냅샷입니다.
+type Stats struct {
+	Requests         uint64 // Requests passed to the handler. // 핸들러에 전달된 요청 수입니다.
+	KeepAliveReuses  uint64 // Requests served on a connection that had already served one.
+	BytesRead        uint64 // HTTP bytes read (plaintext for TLS connections).
+	BytesWritten     uint64 // HTTP bytes written (plaintext for TLS connections).
+	ParseErrors      uint64 // Malformed requests that caused the connection to be closed.
+	HandlerPanics    uint64 // Panics recovered from handlers and read handlers.
+	ReadTimeouts     uint64 // Connections closed by the header timeout or minimum body rate.
+	ActiveHijacked   int64  // Hijacked connections (e.g. WebSocket) that are still open.
+	ConcurrencyLimit int    // Current WithAdaptiveLimit limit, or 0 without one.
+	LimitRejections  uint64 // Requests shed with 503 by WithAdaptiveLimit.
+
+	RequestDuration Histogram // Time from a parsed request to the end of its response, in seconds.
+	RequestSize     Histogram // Bytes consumed per request, headers and body included.
+}
+
+// Histogram is a cumulative histogram snapshot, laid out like a Prometheus histogram.
+// Histogram은 Prometheus 히스토그램 형식의 누적 히스토그램 스냅샷입니다.
+type Histogram struct {
+	Bounds []float64 // Upper bounds of the buckets, excluding +Inf.
+	Counts []uint64  // Cumulative count of observations <= Bounds[i].
+	Count  uint64    // Total number of observations.
+	Sum    float64   // Sum of all observations.
+}
+
+// engineStats holds the live counters behind Stats.
+type engineStats struct {
+	requests        atomic.Uint64
+	keepAliveReuses atomic.Uint64
+	bytesRead       atomic.Uint64
+	bytesWritten    atomic.Uint64
+	parseErrors     atomic.Uint64
+	handlerPanics   atomic.Uint64
+	readTimeouts    atomic.Uint64
+	activeHijacked  atomic.Int64
+
+	requestDuration *histogram
+	requestSize     *histogram
+}
+
+// histogram records observations in integer units (nanoseconds, bytes) with atomics.
+type histogram struct {
+	bounds   []uint64  // Upper bounds in recorded units.
+	reported []float64 // Upper bounds as configured, in reported units.
+	scale    float64   // Multiplier converting recorded units to reported units.
+	counts   []atomic.Uint64
+	count    atomic.Uint64
+	sum      atomic.Uint64
+}
+
+func newHistogram(bounds []float64, scale float64) *histogram {
+	h := &histogram{
+		bounds:   make([]uint64, len(bounds)),
+		reported: bounds,
+		scale:    scale,
+		counts:   make([]atomic.Uint64, len(bounds)),
+	}
+	for i, b := range bounds {
+		// Bounds such as 0.25s are not exact in binary; truncating would move them a unit down.
+		h.bounds[i] = uint64(math.Round(b / scale))
+	}
+	return h
+}
+
+func (h *histogram) observe(v uint64) {
+	// Buckets are few, so a linear scan beats a binary search.
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(v)
+}
+
+// snapshot reads the buckets before the total. observe counts an observation in its
+// bucket first, so a concurrent one may be in a bucket but not yet in count; Count is
+// raised to the last cumulative bucket so the exposition stays monotonic.
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Bounds: make([]float64, len(h.bounds)),
+		Counts: make([]uint64, len(h.bounds)),
+	}
+	copy(s.Bounds, h.reported)
+	var cum uint64
+	for i := range h.bounds {
+		cum += h.counts[i].Load()
+		s.Counts[i] = cum
+	}
+	s.Count = max(h.count.Load(), cum)
+	s.Sum = float64(h.sum.Load()) * h.scale
+	return s
+}
+
+func (s *engineStats) init() {
+	s.requestDuration = newHistogram(DurationBuckets, float64(time.Nanosecond)/float64(time.Second))
+	s.requestSize = newHistogram(SizeBuckets, 1)
+}
+
+// Stats returns a snapshot of the engine's counters.
+// Stats는 엔진 카운터의 스냅샷을 반환합니다.
+func (e *Engine) Stats() Stats {
+	s := Stats{
+		Requests:        e.stats.requests.Load(),
+		KeepAliveReuses: e.stats.keepAliveReuses.Load(),
+		BytesRead:       e.stats.bytesRead.Load(),
+		BytesWritten:    e.stats.bytesWritten.Load(),
+		ParseErrors:     e.stats.parseErrors.Load(),
+		HandlerPanics:   e.stats.handlerPanics.Load(),
+		ReadTimeouts:    e.stats.readTimeouts.Load(),
+		ActiveHijacked:  e.stats.activeHijacked.Load(),
+		RequestDuration: e.stats.requestDuration.snapshot(),
+		RequestSize:     e.stats.requestSize.snapshot(),
+	}
+	if e.limiter != nil {
+		ls := e.limiter.Stats()
+		s.ConcurrencyLimit, s.LimitRejections = ls.Limit, ls.Rejected
+	}
+	return s
+}
+
+// countingConn counts the bytes the engine's buffered reader and writer move
+// through the connection. It lives inside ConnectionState, so it costs no allocation.
+type countingConn struct {
+	io.ReadWriter
+	stats *engineStats
+	read  uint64    // Bytes read on this connection; only touched by the processing goroutine.
+	gate  *readGate // Set when reads can be paused; netpoll can only wait to flush a polled connection.
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriter.Read(p)
+	c.stats.bytesRead.Add(uint64(n))
+	c.read += uint64(n)
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	if c.gate != nil {
+		c.gate.resume()
+	}
+	n, err := c.ReadWriter.Write(p)
+	c.stats.bytesWritten.Add(uint64(n))
+	return n, err
+}
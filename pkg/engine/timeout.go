@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/netpoll"
+)
+
+// WithReadHeaderTimeout limits how long a client may take to send a request's headers,
+// measured from the moment its first byte is seen to the end of the header block.
+// Connections that exceed it are closed. It is enforced with a per-connection timer,
+// so no goroutine waits on slow clients.
+// WithReadHeaderTimeout은 요청의 첫 바이트부터 헤더 끝까지 허용되는 시간을 제한합니다.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(e *Engine) {
+		e.readHeaderTimeout = d
+	}
+}
+
+// WithMinBodyRate requires request bodies to arrive at bytesPerSecond or faster once
+// grace has elapsed after the headers. Connections that fall behind are closed.
+// WithMinBodyRate는 헤더 수신 후 grace가 지나면 요청 본문이 최소 bytesPerSecond 속도로
+// 도착하도록 요구합니다.
+func WithMinBodyRate(bytesPerSecond float64, grace time.Duration) Option {
+	return func(e *Engine) {
+		e.minBodyRate = bytesPerSecond
+		e.bodyRateGrace = grace
+	}
+}
+
+// armReadDeadline is called when serveHTTP sees an incomplete request of available bytes
+// whose header block is headerLen bytes long (0 if the headers are still incomplete).
+// It starts or moves the connection's read deadline, closing the connection if the
+// deadline has already passed.
+func (e *Engine) armReadDeadline(conn netpoll.Connection, state *ConnectionState, available, headerLen int) {
+	switch {
+	case headerLen == 0:
+		if e.readHeaderTimeout <= 0 {
+			return
+		}
+		now := time.Now()
+		if state.reqStart.IsZero() {
+			state.reqStart = now
+		}
+		e.setReadDeadline(conn, state, state.reqStart.Add(e.readHeaderTimeout).Sub(now))
+	case e.minBodyRate > 0:
+		e.armBodyDeadline(conn, state, int64(available-headerLen))
+	default:
+		e.clearReadDeadline(state)
+	}
+}
+
+// armBodyDeadline moves the read deadline to the latest time at which received body
+// bytes still satisfy the minimum body rate.
+func (e *Engine) armBodyDeadline(conn netpoll.Connection, state *ConnectionState, received int64) {
+	now := time.Now()
+	if state.bodyStart.IsZero() {
+		state.bodyStart = now
+	}
+	// The body must have reached received bytes by bodyStart+grace+received/rate.
+	deadline := state.bodyStart.Add(e.bodyRateGrace + time.Duration(float64(received)/e.minBodyRate*float64(time.Second)))
+	e.setReadDeadline(conn, state, deadline.Sub(now))
+}
+
+func (e *Engine) setReadDeadline(conn netpoll.Connection, state *ConnectionState, wait time.Duration) {
+	if state.readTimer == nil {
+		state.readTimer = &readTimer{conn: conn, id: state.ID, remote: state.RemoteAddr, e: e}
+	}
+	state.readTimer.arm(wait)
+}
+
+// clearReadDeadline stops the read deadline once a request has been fully received.
+func (e *Engine) clearReadDeadline(state *ConnectionState) {
+	if state.readTimer != nil {
+		state.readTimer.stop()
+	}
+	state.reqStart = time.Time{}
+	state.bodyStart = time.Time{}
+}
+
+// readTimer closes a connection whose request did not arrive in time. It only holds
+// what it needs to do so, since it may fire after the ConnectionState was released.
+type readTimer struct {
+	e      *Engine
+	conn   netpoll.Connection
+	id     uint64
+	remote string
+	timer  *time.Timer
+	fired  atomic.Bool
+}
+
+func (t *readTimer) arm(wait time.Duration) {
+	switch {
+	case wait <= 0:
+		t.fire()
+	case t.timer == nil:
+		t.timer = time.AfterFunc(wait, t.fire)
+	default:
+		t.timer.Reset(wait)
+	}
+}
+
+func (t *readTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *readTimer) fire() {
+	if !t.fired.CompareAndSwap(false, true) {
+		return
+	}
+	t.e.stats.readTimeouts.Add(1)
+	t.e.logger.Debug("request read timed out", "conn_id", t.id, "remote_addr", t.remote)
+	t.conn.Close()
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/netpoll"
+)
+
+// tlsReadChunk is the plaintext buffer size reserved per decrypt call (max TLS record payload).
+const tlsReadChunk = 16 * 1024
+
+// DefaultTLSHandshakeTimeout bounds a TLS handshake, from the moment the connection is
+// accepted, unless SetHandshakeTimeout changes it.
+// DefaultTLSHandshakeTimeout은 TLS 핸드셰이크에 허용되는 기본 시간입니다.
+const DefaultTLSHandshakeTimeout = 10 * time.Second
+
+const (
+	recordTypeHandshake = 22      // TLS record content type carrying handshake messages.
+	maxClientHello      = 1 << 16 // Larger ClientHellos are left to crypto/tls to reject.
+)
+
+// errTLSWouldBlock is returned by tlsRawConn when the netpoll buffer is empty.
+// crypto/tls does not latch temporary net.Errors, so the record layer can be resumed later.
+var errTLSWouldBlock = &wouldBlockError{}
+
+type wouldBlockError struct{}
+
+func (e *wouldBlockError) Error() string   { return "tls: would block" }
+func (e *wouldBlockError) Timeout() bool   { return false }
+func (e *wouldBlockError) Temporary() bool { return true }
+
+// tlsRawConn feeds ciphertext from the netpoll connection into crypto/tls.
+// In non-blocking mode it only hands out bytes already buffered by the reactor.
+type tlsRawConn struct {
+	netpoll.Connection
+	blocking atomic.Bool
+	pending  []byte // Ciphertext taken from the reactor before the handshake started.
+}
+
+func (c *tlsRawConn) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	if !c.blocking.Load() && c.Connection.Reader().Len() == 0 {
+		return 0, errTLSWouldBlock
+	}
+	return c.Connection.Read(p)
+}
+
+// TLSConn wraps a netpoll.Connection with a TLS record layer.
+// Decrypted bytes are kept in a LinkBuffer exposed through Reader(), so the engine
+// and the websocket reactor can peek at plaintext exactly like a plain connection.
+// TLSConn은 netpoll.Connection을 TLS 레코드 계층으로 래핑합니다.
+type TLSConn struct {
+	netpoll.Connection
+	raw           *tlsRawConn
+	conn          *tls.Conn
+	plain         *netpoll.LinkBuffer
+	state         *tls.ConnectionState
+	handshakeDone bool
+	timer         *time.Timer // Closes the connection if the handshake takes too long.
+}
+
+// NewTLSConn creates a server-side TLSConn for the given connection.
+// NewTLSConn은 주어진 연결에 대한 서버 측 TLSConn을 생성합니다.
+func NewTLSConn(conn netpoll.Connection, config *tls.Config) *TLSConn {
+	raw := &tlsRawConn{Connection: conn}
+	c := &TLSConn{
+		Connection: conn,
+		raw:        raw,
+		conn:       tls.Server(raw, config),
+		plain:      netpoll.NewLinkBuffer(),
+	}
+	c.timer = time.AfterFunc(DefaultTLSHandshakeTimeout, func() {
+		_ = conn.Close()
+	})
+	return c
+}
+
+// SetHandshakeTimeout changes how long the handshake may take, counted from now.
+// SetHandshakeTimeout은 핸드셰이크에 허용되는 시간을 지금부터 다시 설정합니다.
+func (c *TLSConn) SetHandshakeTimeout(d time.Duration) {
+	if !c.handshakeDone {
+		c.timer.Reset(d)
+	}
+}
+
+// Pump completes the handshake if needed and decrypts every record currently
+// buffered by the reactor. Until the whole ClientHello has arrived it only collects
+// ciphertext, so a slow client costs no goroutine. crypto/tls cannot resume a partial
+// handshake, so the rest of it blocks for the client's reply to the server's flight,
+// one round trip bounded by the handshake timeout.
+// Pump는 필요 시 핸드셰이크를 완료하고 현재 버퍼링된 모든 레코드를 복호화합니다.
+func (c *TLSConn) Pump() error {
+	if !c.handshakeDone {
+		// Take the ciphertext off the reactor's buffer, which must be drained on every wake-up.
+		if r := c.Connection.Reader(); r.Len() > 0 {
+			buf, err := r.Next(r.Len())
+			if err != nil {
+				return err
+			}
+			c.raw.pending = append(c.raw.pending, buf...)
+			_ = r.Release()
+		}
+		if !clientHelloComplete(c.raw.pending) {
+			return nil
+		}
+		c.raw.blocking.Store(true)
+		err := c.conn.Handshake()
+		c.raw.blocking.Store(false)
+		if err != nil {
+			return err
+		}
+		c.timer.Stop()
+		state := c.conn.ConnectionState()
+		c.state = &state
+		c.handshakeDone = true
+	}
+
+	_ = c.plain.Release()
+	for {
+		buf, err := c.plain.Malloc(tlsReadChunk)
+		if err != nil {
+			return err
+		}
+		n, err := c.conn.Read(buf)
+		_ = c.plain.MallocAck(n)
+		_ = c.plain.Flush()
+		if err != nil {
+			if err == errTLSWouldBlock {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// TLSConnectionState returns the negotiated TLS state, or nil before the handshake.
+// The same pointer is shared by all requests on the connection.
+func (c *TLSConn) TLSConnectionState() *tls.ConnectionState {
+	return c.state
+}
+
+// Reader returns the decrypted input buffer.
+func (c *TLSConn) Reader() netpoll.Reader {
+	return c.plain
+}
+
+// Read reads decrypted data, blocking on the underlying connection if none is buffered.
+func (c *TLSConn) Read(p []byte) (int, error) {
+	if n := c.plain.Len(); n > 0 {
+		buf, err := c.plain.Next(min(n, len(p)))
+		if err != nil {
+			return 0, err
+		}
+		return copy(p, buf), nil
+	}
+
+	c.raw.blocking.Store(true)
+	defer c.raw.blocking.Store(false)
+	return c.conn.Read(p)
+}
+
+// Write encrypts p and writes it to the underlying connection.
+func (c *TLSConn) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+// Close sends a close_notify alert (if the handshake completed) and closes the connection.
+func (c *TLSConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *TLSConn) release() {
+	c.timer.Stop()
+	_ = c.plain.Close()
+}
+
+// clientHelloComplete reports whether b, the start of a connection, holds the whole
+// first handshake message, which may span several records. Input that does not look
+// like a handshake record is reported complete so crypto/tls can reject it.
+func clientHelloComplete(b []byte) bool {
+	if len(b) < 5 {
+		return false
+	}
+	if b[0] != recordTypeHandshake || int(b[3])<<8|int(b[4]) < 4 {
+		return true
+	}
+	if len(b) < 9 {
+		return false
+	}
+	need := 4 + (int(b[6])<<16 | int(b[7])<<8 | int(b[8]))
+	if need > maxClientHello {
+		return true
+	}
+	for need > 0 {
+		if len(b) < 5 {
+			return false
+		}
+		n := int(b[3])<<8 | int(b[4])
+		if len(b) < 5+n {
+			return false
+		}
+		need -= n
+		b = b[5+n:]
+	}
+	return true
+}
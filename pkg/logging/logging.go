@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Discard returns a logger that drops every record, for silencing Hon entirely.
+// Discard는 모든 레코드를 버리는 로거를 반환합니다.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// RateLimit wraps h so that each distinct message is emitted at most burst times per
+// interval. Dropped records are counted and reported as a "suppressed" attribute on the
+// next record with the same message that gets through. Limits are keyed by the
+// message text, which Hon keeps constant (details go in attributes).
+// RateLimit은 메시지별로 interval당 최대 burst개의 레코드만 출력하도록 h를 감쌉니다.
+func RateLimit(h slog.Handler, interval time.Duration, burst int) slog.Handler {
+	return &rateLimitHandler{
+		next:  h,
+		state: &rateLimitState{interval: interval, burst: max(burst, 1), windows: make(map[string]*window)},
+	}
+}
+
+type rateLimitHandler struct {
+	next  slog.Handler
+	state *rateLimitState // Shared by handlers derived through WithAttrs/WithGroup.
+}
+
+type rateLimitState struct {
+	interval time.Duration
+	burst    int
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether a record with msg may pass and how many were dropped before it.
+func (s *rateLimitState) allow(msg string, now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[msg]
+	if !ok {
+		w = &window{start: now}
+		s.windows[msg] = w
+	}
+	if now.Sub(w.start) >= s.interval {
+		w.start = now
+		w.count = 0
+	}
+	if w.count >= s.burst {
+		w.suppressed++
+		return false, 0
+	}
+	w.count++
+	suppressed := w.suppressed
+	w.suppressed = 0
+	return true, suppressed
+}
+
+func (h *rateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *rateLimitHandler) Handle(ctx context.Context, r slog.Record) error {
+	now := r.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	ok, suppressed := h.state.allow(r.Message, now)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *rateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &rateLimitHandler{next: h.next.WithAttrs(attrs), state: h.state}
+}
+
+func (h *rateLimitHandler) WithGroup(name string) slog.Handler {
+	return &rateLimitHandler{next: h.next.WithGroup(name), state: h.state}
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit_SuppressesAndReports(t *testing.T) {
+	var buf bytes.Buffer
+	h := RateLimit(slog.NewTextHandler(&buf, nil), time.Minute, 2)
+	logger := slog.New(h).With("component", "test")
+
+	start := time.Now()
+	emit := func(at time.Time, msg string) {
+		r := slog.NewRecord(at, slog.LevelInfo, msg, 0)
+		if err := logger.Handler().Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		emit(start, "read error")
+	}
+	emit(start, "other")
+	if got := strings.Count(buf.String(), "msg=\"read error\""); got != 2 {
+		t.Fatalf("Expected 2 records within the window, got %d:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "msg=other") {
+		t.Errorf("Expected a different message to have its own budget:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	emit(start.Add(time.Minute), "read error")
+	if !strings.Contains(buf.String(), "suppressed=3") {
+		t.Errorf("Expected the next window to report 3 suppressed records, got:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "component=test") {
+		t.Errorf("Expected attributes from With to be kept, got:\n%s", buf.String())
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	if Discard().Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected Discard logger to be disabled at every level")
+	}
+}
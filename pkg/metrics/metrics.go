@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/DevNewbie1826/hon/pkg/engine"
+	"github.com/DevNewbie1826/hon/pkg/server"
+	"github.com/DevNewbie1826/hon/pkg/websocket"
+)
+
+// contentType is the Prometheus text exposition format version 0.0.4.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var bufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 8*1024)
+		return &b
+	},
+}
+
+// Handler returns an http.Handler that renders the server's counters, its engine's
+// request metrics and the WebSocket connection counts in the Prometheus text format.
+// Mount it on any route and point a scraper at it.
+// Handler는 서버/엔진/WebSocket 지표를 Prometheus 텍스트 형식으로 출력하는 http.Handler를 반환합니다.
+func Handler(s *server.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bp := bufPool.Get().(*[]byte)
+		b := Append((*bp)[:0], s.Stats(), websocket.Stats())
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		_, _ = w.Write(b)
+
+		*bp = b
+		bufPool.Put(bp)
+	})
+}
+
+// Append renders stats in the Prometheus text format and appends it to b.
+// Append는 통계를 Prometheus 텍스트 형식으로 b에 덧붙입니다.
+func Append(b []byte, s server.Stats, ws websocket.ConnStats) []byte {
+	b = gauge(b, "hon_connections_active", "Connections currently holding a MaxConns slot.", float64(s.ActiveConns))
+	b = gauge(b, "hon_connections_queued", "Connections waiting in the overload queue.", float64(s.QueuedConns))
+	b = counter(b, "hon_connections_total", "Connections accepted.", s.TotalConns)
+
+	b = header(b, "hon_connections_rejected_total", "Connections refused at accept time.", "counter")
+	for _, r := range []struct {
+		reason server.RejectReason
+		n      uint64
+	}{
+		{server.RejectMaxConns, s.RejectedConns.MaxConns},
+		{server.RejectPerIP, s.RejectedConns.PerIP},
+		{server.RejectPerCIDR, s.RejectedConns.PerCIDR},
+		{server.RejectRate, s.RejectedConns.Rate},
+	} {
+		b = append(b, `hon_connections_rejected_total{reason="`...)
+		b = append(b, r.reason.String()...)
+		b = append(b, `"} `...)
+		b = strconv.AppendUint(b, r.n, 10)
+		b = append(b, '\n')
+	}
+
+	b = gauge(b, "hon_connections_hijacked_active", "Hijacked connections that are still open.", float64(s.ActiveHijacked))
+	b = counter(b, "hon_http_requests_total", "Requests passed to the handler.", s.Requests)
+	b = counter(b, "hon_http_keepalive_reuses_total", "Requests served on a reused connection.", s.KeepAliveReuses)
+	b = counter(b, "hon_http_read_bytes_total", "HTTP bytes read.", s.BytesRead)
+	b = counter(b, "hon_http_written_bytes_total", "HTTP bytes written.", s.BytesWritten)
+	b = counter(b, "hon_http_parse_errors_total", "Malformed requests.", s.ParseErrors)
+	b = counter(b, "hon_http_handler_panics_total", "Panics recovered from handlers.", s.HandlerPanics)
+	b = counter(b, "hon_http_read_timeouts_total", "Connections closed for sending a request too slowly.", s.ReadTimeouts)
+	b = gauge(b, "hon_http_concurrency_limit", "Current adaptive in-flight request limit (0 if disabled).", float64(s.ConcurrencyLimit))
+	b = counter(b, "hon_http_limit_rejections_total", "Requests shed by the adaptive concurrency limit.", s.LimitRejections)
+	b = histogram(b, "hon_http_request_duration_seconds", "Time from a parsed request to the end of its response.", s.RequestDuration)
+	b = histogram(b, "hon_http_request_size_bytes", "Bytes consumed per request, headers and body included.", s.RequestSize)
+
+	b = gauge(b, "hon_websocket_connections_active", "Upgraded WebSocket connections that are still open.", float64(ws.Active))
+	b = counter(b, "hon_websocket_connections_total", "WebSocket connections upgraded.", ws.Total)
+	return b
+}
+
+func header(b []byte, name, help, typ string) []byte {
+	b = append(b, "# HELP "...)
+	b = append(b, name...)
+	b = append(b, ' ')
+	b = append(b, help...)
+	b = append(b, "\n# TYPE "...)
+	b = append(b, name...)
+	b = append(b, ' ')
+	b = append(b, typ...)
+	return append(b, '\n')
+}
+
+func gauge(b []byte, name, help string, v float64) []byte {
+	b = header(b, name, help, "gauge")
+	b = append(b, name...)
+	b = append(b, ' ')
+	b = appendFloat(b, v)
+	return append(b, '\n')
+}
+
+func counter(b []byte, name, help string, v uint64) []byte {
+	b = header(b, name, help, "counter")
+	b = append(b, name...)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, v, 10)
+	return append(b, '\n')
+}
+
+func histogram(b []byte, name, help string, h engine.Histogram) []byte {
+	b = header(b, name, help, "histogram")
+	for i, bound := range h.Bounds {
+		b = append(b, name...)
+		b = append(b, `_bucket{le="`...)
+		b = appendFloat(b, bound)
+		b = append(b, `"} `...)
+		b = strconv.AppendUint(b, h.Counts[i], 10)
+		b = append(b, '\n')
+	}
+	b = append(b, name...)
+	b = append(b, `_bucket{le="+Inf"} `...)
+	b = strconv.AppendUint(b, h.Count, 10)
+	b = append(b, '\n')
+
+	b = append(b, name...)
+	b = append(b, "_sum "...)
+	b = appendFloat(b, h.Sum)
+	b = append(b, '\n')
+	b = append(b, name...)
+	b = append(b, "_count "...)
+	b = strconv.AppendUint(b, h.Count, 10)
+	return append(b, '\n')
+}
+
+func appendFloat(b []byte, v float64) []byte {
+	return strconv.AppendFloat(b, v, 'g', -1, 64)
+}
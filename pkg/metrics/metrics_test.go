@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DevNewbie1826/hon/pkg/engine"
+	"github.com/DevNewbie1826/hon/pkg/server"
+	"github.com/DevNewbie1826/hon/pkg/websocket"
+)
+
+func TestAppend_Format(t *testing.T) {
+	s := server.Stats{
+		ActiveConns:   3,
+		TotalConns:    10,
+		RejectedConns: server.RejectStats{PerIP: 2},
+		Stats: engine.Stats{
+			Requests:         7,
+			ConcurrencyLimit: 12,
+			RequestDuration: engine.Histogram{
+				Bounds: []float64{0.1, 1},
+				Counts: []uint64{4, 6},
+				Count:  7,
+				Sum:    3.5,
+			},
+		},
+	}
+	out := string(Append(nil, s, websocket.ConnStats{Active: 1, Total: 5}))
+
+	for _, want := range []string{
+		"# TYPE hon_connections_active gauge\nhon_connections_active 3\n",
+		"hon_connections_total 10\n",
+		`hon_connections_rejected_total{reason="per_ip"} 2` + "\n",
+		"hon_http_requests_total 7\n",
+		"# TYPE hon_http_concurrency_limit gauge\nhon_http_concurrency_limit 12\n",
+		"# TYPE hon_http_request_duration_seconds histogram\n",
+		`hon_http_request_duration_seconds_bucket{le="0.1"} 4` + "\n",
+		`hon_http_request_duration_seconds_bucket{le="1"} 6` + "\n",
+		`hon_http_request_duration_seconds_bucket{le="+Inf"} 7` + "\n",
+		"hon_http_request_duration_seconds_sum 3.5\n",
+		"hon_http_request_duration_seconds_count 7\n",
+		"hon_websocket_connections_active 1\n",
+		"hon_websocket_connections_total 5\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i <= 0 {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		if _, err := strconv.ParseFloat(line[i+1:], 64); err != nil {
+			t.Fatalf("malformed sample value in %q: %v", line, err)
+		}
+	}
+}
+
+func TestHandler_ServesLiveStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	srv := server.NewServer(engine.NewEngine(mux))
+	mux.Handle("/metrics", Handler(srv))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	base := "http://" + l.Addr().String()
+	resp, err := http.Get(base + "/")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	resp, err = http.Get(base + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != contentType {
+		t.Fatalf("unexpected Content-Type %q", ct)
+	}
+	out := string(body)
+	for _, want := range []string{
+		"hon_connections_active 1\n",
+		// The scrape itself is in flight, so only the first request has been observed.
+		"hon_http_request_duration_seconds_count 1\n",
+		"hon_http_request_size_bytes_count 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cloudwego/netpoll"
+)
+
+// RejectReason identifies the accept-time limit that refused a connection.
+// RejectReason은 연결을 거부한 수락 시점 제한을 나타냅니다.
+type RejectReason uint8
+
+const (
+	RejectMaxConns RejectReason = iota // Global WithMaxConns cap.
+	RejectPerIP                        // WithMaxConnsPerIP cap.
+	RejectPerCIDR                      // WithMaxConnsPerCIDR cap.
+	RejectRate                         // WithAcceptRate or WithAcceptRatePerIP bucket is empty.
+	numRejectReasons
+)
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectMaxConns:
+		return "max_conns"
+	case RejectPerIP:
+		return "per_ip"
+	case RejectPerCIDR:
+		return "per_cidr"
+	case RejectRate:
+		return "rate"
+	}
+	return "unknown"
+}
+
+// RejectAction selects how a connection refused by a per-client limit is terminated.
+// RejectAction은 클라이언트별 제한으로 거부된 연결의 종료 방식을 선택합니다.
+type RejectAction uint8
+
+const (
+	RejectClose           RejectAction = iota // Close gracefully (FIN). // 정상 종료(FIN)합니다.
+	RejectReset                               // Abort with a TCP RST. // TCP RST로 중단합니다.
+	RejectTooManyRequests                     // Send 429 and close; plain close on TLS endpoints. // 429 응답 후 종료합니다.
+)
+
+// tooManyRequestsResponse is written verbatim by RejectTooManyRequests.
+var tooManyRequestsResponse = []byte("HTTP/1.1 429 Too Many Requests\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+
+// RejectStats counts connections refused at accept time, by reason.
+// RejectStats는 수락 시점에 거부된 연결 수를 사유별로 집계합니다.
+type RejectStats struct {
+	MaxConns uint64
+	PerIP    uint64
+	PerCIDR  uint64
+	Rate     uint64
+}
+
+// WithMaxConnsPerIP caps concurrent connections from a single client IP.
+// Limits are evaluated against the socket peer, before any PROXY protocol header is read.
+// WithMaxConnsPerIP는 단일 클라이언트 IP의 동시 연결 수를 제한합니다.
+func WithMaxConnsPerIP(n int) Option {
+	return func(s *Server) {
+		s.limits.perIP = n
+	}
+}
+
+// WithMaxConnsPerCIDR caps concurrent connections from a single network, grouping
+// IPv4 clients by their first v4Bits bits and IPv6 clients by their first v6Bits bits
+// (for example 24 and 64).
+// WithMaxConnsPerCIDR는 네트워크 대역(IPv4는 v4Bits, IPv6는 v6Bits 접두사)별 동시 연결 수를 제한합니다.
+func WithMaxConnsPerCIDR(v4Bits, v6Bits, n int) Option {
+	return func(s *Server) {
+		s.limits.v4Bits = v4Bits
+		s.limits.v6Bits = v6Bits
+		s.limits.perCIDR = n
+	}
+}
+
+// WithAcceptRate limits how many new connections are accepted per second across
+// all clients, allowing bursts of up to burst connections.
+// WithAcceptRate는 전체 클라이언트에 대해 초당 수락하는 새 연결 수를 제한합니다.
+func WithAcceptRate(perSecond float64, burst int) Option {
+	return func(s *Server) {
+		s.limits.rate = perSecond
+		s.limits.burst = float64(max(burst, 1))
+	}
+}
+
+// WithAcceptRatePerIP limits how many new connections a single client IP may open
+// per second, allowing bursts of up to burst connections.
+// WithAcceptRatePerIP는 단일 클라이언트 IP가 초당 열 수 있는 새 연결 수를 제한합니다.
+func WithAcceptRatePerIP(perSecond float64, burst int) Option {
+	return func(s *Server) {
+		s.limits.ipRate = perSecond
+		s.limits.ipBurst = float64(max(burst, 1))
+	}
+}
+
+// WithRejectAction sets how connections refused by per-client limits or accept rates
+// are terminated. The default is RejectClose.
+// WithRejectAction은 클라이언트별 제한으로 거부된 연결의 종료 방식을 설정합니다.
+func WithRejectAction(a RejectAction) Option {
+	return func(s *Server) {
+		s.rejectAction = a
+	}
+}
+
+// RejectedConns returns the number of connections refused at accept time so far.
+// RejectedConns는 지금까지 수락 시점에 거부된 연결 수를 반환합니다.
+func (s *Server) RejectedConns() RejectStats {
+	return RejectStats{
+		MaxConns: s.rejected[RejectMaxConns].Load(),
+		PerIP:    s.rejected[RejectPerIP].Load(),
+		PerCIDR:  s.rejected[RejectPerCIDR].Load(),
+		Rate:     s.rejected[RejectRate].Load(),
+	}
+}
+
+// reject terminates a refused connection according to the configured action.
+func (s *Server) reject(conn netpoll.Connection, reason RejectReason, isTLS bool) {
+	s.rejected[reason].Add(1)
+	s.logger.Debug("connection rejected", "reason", reason.String(), "remote_addr", conn.RemoteAddr())
+	switch s.rejectAction {
+	case RejectReset:
+		if fc, ok := conn.(interface{ Fd() int }); ok {
+			_ = syscall.SetsockoptLinger(fc.Fd(), syscall.SOL_SOCKET, syscall.SO_LINGER, &syscall.Linger{Onoff: 1, Linger: 0})
+		}
+	case RejectTooManyRequests:
+		if !isTLS {
+			_, _ = conn.Writer().WriteBinary(tooManyRequestsResponse)
+			_ = conn.Writer().Flush()
+		}
+	}
+	conn.Close()
+}
+
+// clientIP returns the peer IP used as the limiter key. Non-IP peers
+// (Unix sockets) are not subject to per-client limits.
+func clientIP(addr net.Addr) (netip.Addr, bool) {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	return ip.Unmap(), ok
+}
+
+// bucketSweepInterval bounds how often idle per-IP buckets are pruned.
+const bucketSweepInterval = 10 * time.Second
+
+// tokenBucket is a lazily refilled token bucket.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate, burst float64) bool {
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// connLimits tracks per-client connection counts and accept-rate buckets.
+type connLimits struct {
+	perIP          int
+	perCIDR        int
+	v4Bits, v6Bits int
+	rate, burst    float64
+	ipRate         float64
+	ipBurst        float64
+
+	mu        sync.Mutex
+	global    tokenBucket
+	buckets   map[netip.Addr]*tokenBucket
+	ipConns   map[netip.Addr]int
+	cidrConns map[netip.Prefix]int
+	lastSweep time.Time
+}
+
+// enabled reports whether any per-client limit or accept rate is configured.
+func (l *connLimits) enabled() bool {
+	return l.perIP > 0 || l.perCIDR > 0 || l.rate > 0 || l.ipRate > 0
+}
+
+func (l *connLimits) prefix(ip netip.Addr) netip.Prefix {
+	bits := l.v6Bits
+	if ip.Is4() {
+		bits = l.v4Bits
+	}
+	p, _ := ip.Prefix(bits)
+	return p
+}
+
+// admit checks every limit for a new connection and, if it is accepted,
+// charges it to the client's counters. hasIP is false for non-IP peers,
+// which are only subject to the global accept rate.
+func (l *connLimits) admit(ip netip.Addr, hasIP bool, now time.Time) (RejectReason, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 && !l.global.take(now, l.rate, l.burst) {
+		return RejectRate, false
+	}
+	if !hasIP {
+		return 0, true
+	}
+
+	if l.ipRate > 0 {
+		if l.buckets == nil {
+			l.buckets = make(map[netip.Addr]*tokenBucket)
+			l.lastSweep = now
+		}
+		b, ok := l.buckets[ip]
+		if !ok {
+			b = &tokenBucket{tokens: l.ipBurst, last: now}
+			l.buckets[ip] = b
+		}
+		ok = b.take(now, l.ipRate, l.ipBurst)
+		l.sweepBuckets(now)
+		if !ok {
+			return RejectRate, false
+		}
+	}
+
+	if l.perIP > 0 && l.ipConns[ip] >= l.perIP {
+		return RejectPerIP, false
+	}
+	var p netip.Prefix
+	if l.perCIDR > 0 {
+		p = l.prefix(ip)
+		if l.cidrConns[p] >= l.perCIDR {
+			return RejectPerCIDR, false
+		}
+	}
+
+	if l.perIP > 0 {
+		if l.ipConns == nil {
+			l.ipConns = make(map[netip.Addr]int)
+		}
+		l.ipConns[ip]++
+	}
+	if l.perCIDR > 0 {
+		if l.cidrConns == nil {
+			l.cidrConns = make(map[netip.Prefix]int)
+		}
+		l.cidrConns[p]++
+	}
+	return 0, true
+}
+
+// release undoes the connection counters charged by admit.
+func (l *connLimits) release(ip netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP > 0 {
+		if l.ipConns[ip]--; l.ipConns[ip] <= 0 {
+			delete(l.ipConns, ip)
+		}
+	}
+	if l.perCIDR > 0 {
+		p := l.prefix(ip)
+		if l.cidrConns[p]--; l.cidrConns[p] <= 0 {
+			delete(l.cidrConns, p)
+		}
+	}
+}
+
+// sweepBuckets drops per-IP buckets that have refilled completely, since they
+// are indistinguishable from a fresh bucket. Callers hold l.mu.
+func (l *connLimits) sweepBuckets(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.ipRate >= l.ipBurst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// rejectedCounters holds one counter per RejectReason.
+type rejectedCounters [numRejectReasons]atomic.Uint64
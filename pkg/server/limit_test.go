@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestConnLimits_PerCIDR(t *testing.T) {
+	l := &connLimits{perCIDR: 2, v4Bits: 24, v6Bits: 64}
+	now := time.Now()
+	a, b, c := netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.1.1")
+
+	for _, ip := range []netip.Addr{a, b, c} {
+		if _, ok := l.admit(ip, true, now); !ok {
+			t.Fatalf("expected %v to be admitted", ip)
+		}
+	}
+	if reason, ok := l.admit(a, true, now); ok || reason != RejectPerCIDR {
+		t.Fatalf("expected per-CIDR rejection, got %v %v", reason, ok)
+	}
+	l.release(b)
+	if _, ok := l.admit(a, true, now); !ok {
+		t.Fatal("expected admission after release")
+	}
+}
+
+func TestConnLimits_SweepsIdleBuckets(t *testing.T) {
+	l := &connLimits{ipRate: 10, ipBurst: 5}
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		ip := netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)})
+		l.admit(ip, true, now)
+	}
+	if len(l.buckets) != 100 {
+		t.Fatalf("expected 100 buckets, got %d", len(l.buckets))
+	}
+	l.admit(netip.MustParseAddr("192.0.2.1"), true, now.Add(bucketSweepInterval))
+	if len(l.buckets) != 1 {
+		t.Fatalf("expected idle buckets to be swept, got %d", len(l.buckets))
+	}
+}
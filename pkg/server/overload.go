@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/DevNewbie1826/hon/pkg/engine"
+	"github.com/cloudwego/netpoll"
+)
+
+// WithOverloadResponse makes the server answer connections that exceed MaxConns with a
+// pre-rendered "503 Service Unavailable" before closing them, instead of a bare close.
+// A positive retryAfter is sent as the Retry-After header (rounded up to whole seconds).
+// WithOverloadResponse는 MaxConns를 초과한 연결에 즉시 닫는 대신 503 응답을 보낸 뒤 닫도록 설정합니다.
+func WithOverloadResponse(retryAfter time.Duration) Option {
+	return func(s *Server) {
+		s.overloadResponse = renderOverloadResponse(retryAfter)
+	}
+}
+
+// WithOverloadQueue holds up to maxQueued connections that exceed MaxConns for at most
+// maxWait, serving them in arrival order as capacity frees up. Connections that do not
+// fit in the queue or wait too long get the overload response (or are closed).
+// WithOverloadQueue는 MaxConns를 초과한 연결을 최대 maxWait 동안 대기열에 보관하고,
+// 여유가 생기면 도착 순서대로 처리합니다.
+func WithOverloadQueue(maxWait time.Duration, maxQueued int) Option {
+	return func(s *Server) {
+		s.queueWait = maxWait
+		s.queueMax = maxQueued
+	}
+}
+
+func renderOverloadResponse(retryAfter time.Duration) []byte {
+	b := []byte("HTTP/1.1 503 Service Unavailable\r\n")
+	if retryAfter > 0 {
+		secs := int64((retryAfter + time.Second - 1) / time.Second)
+		b = append(b, "Retry-After: "...)
+		b = strconv.AppendInt(b, secs, 10)
+		b = append(b, "\r\n"...)
+	}
+	return append(b, "Content-Length: 0\r\nConnection: close\r\n\r\n"...)
+}
+
+// acquireConn reserves a MaxConns slot.
+func (s *Server) acquireConn() bool {
+	current := atomic.AddInt32(&s.connsCount, 1)
+	if s.maxConns > 0 && current > s.maxConns {
+		atomic.AddInt32(&s.connsCount, -1)
+		return false
+	}
+	return true
+}
+
+// releaseConn frees a MaxConns slot and hands it to the oldest queued connection.
+func (s *Server) releaseConn() {
+	atomic.AddInt32(&s.connsCount, -1)
+	if s.queueMax > 0 {
+		s.admitWaiters()
+	}
+}
+
+// overloaded terminates a connection refused because MaxConns is reached.
+func (s *Server) overloaded(conn netpoll.Connection, isTLS bool) {
+	s.rejected[RejectMaxConns].Add(1)
+	s.logger.Debug("connection rejected", "reason", RejectMaxConns.String(), "remote_addr", conn.RemoteAddr())
+	if s.overloadResponse != nil && !isTLS {
+		_, _ = conn.Writer().WriteBinary(s.overloadResponse)
+		_ = conn.Writer().Flush()
+	}
+	conn.Close()
+}
+
+// waiter is a connection accepted while the server was at MaxConns.
+// It doubles as the connection context so the request callback can hold
+// processing until the connection is admitted.
+type waiter struct {
+	*engine.ConnectionState
+	conn     netpoll.Connection
+	isTLS    bool
+	done     chan struct{} // Closed once the waiter is admitted or expired.
+	admitted bool          // Written before done is closed.
+	timer    *time.Timer
+}
+
+// enqueue adds w to the overload queue, reporting false if the queue is full.
+func (s *Server) enqueue(w *waiter) bool {
+	s.queueMu.Lock()
+	if len(s.queue) >= s.queueMax || s.draining.Load() {
+		s.queueMu.Unlock()
+		return false
+	}
+	s.queue = append(s.queue, w)
+	w.timer = time.AfterFunc(s.queueWait, func() { s.expire(w) })
+	s.queueMu.Unlock()
+
+	// A slot may have been freed between the failed acquire and the append.
+	s.admitWaiters()
+	return true
+}
+
+// admitWaiters admits queued connections while MaxConns slots are available.
+func (s *Server) admitWaiters() {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	for len(s.queue) > 0 && s.acquireConn() {
+		w := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		w.timer.Stop()
+		w.admitted = true
+		close(w.done)
+	}
+}
+
+// removeWaiter takes w out of the queue, reporting whether it was still queued.
+// Callers hold s.queueMu.
+func (s *Server) removeWaiter(w *waiter) bool {
+	for i, q := range s.queue {
+		if q == w {
+			copy(s.queue[i:], s.queue[i+1:])
+			s.queue[len(s.queue)-1] = nil
+			s.queue = s.queue[:len(s.queue)-1]
+			w.timer.Stop()
+			close(w.done)
+			return true
+		}
+	}
+	return false
+}
+
+// expire rejects w if it is still waiting.
+func (s *Server) expire(w *waiter) {
+	s.queueMu.Lock()
+	removed := s.removeWaiter(w)
+	s.queueMu.Unlock()
+	if removed {
+		s.overloaded(w.conn, w.isTLS)
+	}
+}
+
+// closeWaiter is called when a queued connection closes. It frees the MaxConns
+// slot if the connection had been admitted, or drops it from the queue otherwise.
+func (s *Server) closeWaiter(w *waiter) {
+	s.queueMu.Lock()
+	s.removeWaiter(w)
+	admitted := w.admitted
+	s.queueMu.Unlock()
+	if admitted {
+		s.releaseConn()
+	}
+}
+
+// flushQueue rejects every queued connection; used when shutting down.
+func (s *Server) flushQueue() {
+	s.queueMu.Lock()
+	queue := s.queue
+	s.queue = nil
+	for _, w := range queue {
+		w.timer.Stop()
+		close(w.done)
+	}
+	s.queueMu.Unlock()
+	for _, w := range queue {
+		s.overloaded(w.conn, w.isTLS)
+	}
+}
+
+// serveQueued is the request callback used when the overload queue is enabled.
+// Queued connections block here until they are admitted or expire.
+func (s *Server) serveQueued(ctx context.Context, conn netpoll.Connection) error {
+	if w, ok := ctx.(*waiter); ok {
+		<-w.done
+		if !w.admitted {
+			return nil
+		}
+	}
+	return s.Engine.ServeConn(ctx, conn)
+}
@@ -2,13 +2,21 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/DevNewbie1826/hon/pkg/engine"
+	"github.com/DevNewbie1826/hon/pkg/engine/proxyproto"
 	"github.com/cloudwego/netpoll"
 	"github.com/valyala/fasthttp/reuseport"
 )
@@ -16,13 +24,16 @@ import (
 // Server is the top-level structure for the netpoll server.
 // Server는 netpoll 서버의 최상위 구조체입니다.
 type Server struct {
-	Engine            *engine.Engine    // The request processing engine. // 요청 처리 엔진입니다.
-	eventLoop         netpoll.EventLoop // The netpoll event loop. // netpoll 이벤트 루프입니다.
-	keepAliveTimeout  time.Duration     // Timeout for idle connections. // 유휴 연결에 대한 타임아웃입니다.
-	readTimeout       time.Duration     // Timeout for reading request data. // 요청 데이터 읽기에 대한 타임아웃입니다.
-	writeTimeout      time.Duration     // Timeout for writing response data. // 응답 데이터 쓰기에 대한 타임아웃입니다.
-	maxConns          int32             // Maximum concurrent connections.
-	connsCount        int32             // Current connection count.
+	Engine            *engine.Engine   // The request processing engine. // 요청 처리 엔진입니다.
+	logger            *slog.Logger     // Server lifecycle and connection event logger. // 서버 이벤트 로거입니다.
+	endpoints         []*boundEndpoint // Bound listeners and their netpoll event loops. // 바인딩된 리스너와 이벤트 루프입니다.
+	keepAliveTimeout  time.Duration    // Timeout for idle connections. // 유휴 연결에 대한 타임아웃입니다.
+	handshakeTimeout  time.Duration    // Timeout for TLS handshakes; 0 means engine.DefaultTLSHandshakeTimeout.
+	readTimeout       time.Duration    // Timeout for reading request data. // 요청 데이터 읽기에 대한 타임아웃입니다.
+	writeTimeout      time.Duration    // Timeout for writing response data. // 응답 데이터 쓰기에 대한 타임아웃입니다.
+	maxConns          int32            // Maximum concurrent connections.
+	connsCount        int32            // Current connection count.
+	acceptedConns     atomic.Uint64    // Connections accepted since start, for Stats.
 	mu                sync.RWMutex
 	shutdownRequested atomic.Bool
 	serving           atomic.Bool
@@ -30,9 +41,36 @@ type Server struct {
 	startedOnce       sync.Once
 	ready             chan struct{}
 	readyOnce         sync.Once
+
+	connsMu            sync.Mutex
+	conns              map[*engine.ConnectionState]netpoll.Connection // Live connections, for draining.
+	draining           atomic.Bool
+	onShutdownHijacked func(conn net.Conn)
+
+	upgradeCommand func() (*exec.Cmd, error)
+
+	proxyMode    proxyproto.Mode
+	proxyTrusted []netip.Prefix
+
+	limits       connLimits
+	rejectAction RejectAction
+	rejected     rejectedCounters
+
+	overloadResponse []byte // Pre-rendered 503 sent when MaxConns is exceeded, if set.
+	queueWait        time.Duration
+	queueMax         int
+	queueMu          sync.Mutex
+	queue            []*waiter // Connections waiting for a MaxConns slot, oldest first.
 }
 
-var ErrServerAlreadyServing = errors.New("server already serving")
+// unixScheme is the address prefix selecting a Unix domain socket listener.
+const unixScheme = "unix://"
+
+var (
+	ErrServerAlreadyServing = errors.New("server already serving")
+	ErrMissingCertificate   = errors.New("server: TLS config has no certificate")
+	ErrNoEndpoints          = errors.New("server: no endpoints to serve")
+)
 
 // Option is a function type for configuring the Server.
 // Option은 서버 설정을 위한 함수 타입입니다.
@@ -69,6 +107,47 @@ func WithKeepAliveTimeout(d time.Duration) Option {
 	}
 }
 
+// WithTLSHandshakeTimeout limits how long a client may take to complete the TLS
+// handshake, from the moment its connection is accepted. The default is
+// engine.DefaultTLSHandshakeTimeout.
+// WithTLSHandshakeTimeout은 TLS 핸드셰이크에 허용되는 시간을 설정합니다.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.handshakeTimeout = d
+	}
+}
+
+// WithOnShutdownHijacked registers a hook called for every hijacked connection
+// (e.g. WebSocket) when Shutdown starts, before the connection is force-closed.
+// Use it to send a close frame such as 1001 Going Away.
+// WithOnShutdownHijacked는 Shutdown 시작 시 하이재킹된 각 연결에 대해 호출되는 훅을 등록합니다.
+func WithOnShutdownHijacked(fn func(conn net.Conn)) Option {
+	return func(s *Server) {
+		s.onShutdownHijacked = fn
+	}
+}
+
+// WithProxyProtocol enables HAProxy PROXY protocol (v1 and v2) parsing on accepted
+// connections. When trusted prefixes are given, only peers inside them may send a
+// header; other connections are served as if the option were off.
+// WithProxyProtocol은 수락된 연결에서 HAProxy PROXY 프로토콜(v1, v2) 파싱을 활성화합니다.
+// 신뢰 대역이 주어지면 해당 대역의 피어만 헤더를 보낼 수 있습니다.
+func WithProxyProtocol(mode proxyproto.Mode, trusted ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.proxyMode = mode
+		s.proxyTrusted = trusted
+	}
+}
+
+// WithLogger sets the logger for server lifecycle and connection events.
+// The default is slog.Default(); see the logging package to silence or rate-limit it.
+// WithLogger는 서버 수명 주기와 연결 이벤트를 기록할 로거를 설정합니다.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
 // NewServer creates a new Server.
 // NewServer는 새로운 Server를 생성합니다.
 func NewServer(e *engine.Engine, opts ...Option) *Server {
@@ -80,11 +159,15 @@ func NewServer(e *engine.Engine, opts ...Option) *Server {
 		maxConns:         0, // Default: Unlimited
 		started:          make(chan struct{}),
 		ready:            make(chan struct{}),
+		conns:            make(map[*engine.ConnectionState]netpoll.Connection),
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
 
 	return s
 }
@@ -101,14 +184,157 @@ func (s *Server) markReady() {
 	})
 }
 
+// Endpoint describes one socket served by a Server.
+// Endpoint는 Server가 처리하는 하나의 소켓을 설명합니다.
+type Endpoint struct {
+	Addr      string       // "host:port" or "unix:///path". Ignored when Listener is set. // 주소입니다.
+	Listener  net.Listener // Optional pre-bound *net.TCPListener or *net.UnixListener. // 미리 바인딩된 리스너입니다.
+	TLSConfig *tls.Config  // Optional; enables TLS termination for this endpoint. // TLS 종료를 활성화합니다.
+}
+
+// boundEndpoint is a bound Endpoint together with its event loop.
+type boundEndpoint struct {
+	addr         string
+	listener     net.Listener      // Original listener, kept for Upgrade.
+	pollListener *endpointListener // netpoll view of listener.
+	eventLoop    netpoll.EventLoop
+	done         chan struct{} // Closed when eventLoop.Serve returns.
+}
+
+// errListenerStopped is returned to netpoll by a stopped listener. netpoll only lets go
+// of a listener whose accept fails with an error mentioning "closed".
+var errListenerStopped = errors.New("server: listener closed")
+
+// endpointListener is the listener netpoll serves an endpoint from. It can be stopped
+// before netpoll shuts the endpoint down, and closing it is idempotent, so Shutdown can
+// close the socket early without netpoll closing the descriptor again later.
+type endpointListener struct {
+	netpoll.Listener
+	mu      sync.RWMutex
+	stopped bool
+	closed  bool
+}
+
+func (l *endpointListener) Accept() (net.Conn, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.stopped {
+		return nil, errListenerStopped
+	}
+	return l.Listener.Accept()
+}
+
+func (l *endpointListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.Listener.Close()
+}
+
+// stop makes every later accept fail.
+func (l *endpointListener) stop() {
+	l.mu.Lock()
+	l.stopped = true
+	l.mu.Unlock()
+}
+
+// isStopped reports whether the listener was stopped or closed.
+func (l *endpointListener) isStopped() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.stopped
+}
+
+// stopAccepting closes the endpoint's listening socket while the connections it has
+// accepted drain, so new clients are refused (or, after Upgrade, reach the new process)
+// instead of being accepted and then cut off. netpoll has to stop polling the socket
+// before it is closed, which it does when an accept fails; a connection to the
+// listener wakes it up for that. If that cannot be done, the socket stays open until
+// the event loop shuts down.
+func (b *boundEndpoint) stopAccepting(ctx context.Context) {
+	b.pollListener.stop()
+	addr := b.pollListener.Addr()
+	c, err := net.DialTimeout(addr.Network(), addr.String(), time.Second)
+	if err != nil {
+		return
+	}
+	c.Close()
+	select {
+	case <-b.done:
+		_ = b.pollListener.Close()
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+	}
+}
+
+// shutdown stops the endpoint's event loop and waits for Serve to return.
+// eventLoop.Shutdown is a no-op if it runs before Serve has installed its server,
+// so it is retried until Serve is seen to exit.
+func (b *boundEndpoint) shutdown(ctx context.Context) error {
+	for {
+		if err := b.eventLoop.Shutdown(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-b.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
 // Serve starts the netpoll event loop to handle incoming requests.
 // It uses SO_REUSEPORT for improved multi-process/thread binding performance.
+// An address of the form "unix:///path/to/sock" listens on a Unix domain socket.
 // Serve는 netpoll 이벤트 루프를 시작하여 들어오는 요청을 처리합니다.
 // SO_REUSEPORT를 사용하여 다중 프로세스/스레드 바인딩 성능을 향상시킵니다.
+// "unix:///path/to/sock" 형식의 주소는 Unix 도메인 소켓에서 수신합니다.
 func (s *Server) Serve(addr string) error {
+	return s.ServeEndpoints(Endpoint{Addr: addr})
+}
+
+// ServeListener serves connections accepted on an already-bound listener
+// (e.g. systemd socket activation or an ephemeral test port).
+// Only *net.TCPListener and *net.UnixListener are supported. The listener is closed on Shutdown.
+// ServeListener는 이미 바인딩된 리스너에서 수락된 연결을 처리합니다.
+func (s *Server) ServeListener(l net.Listener) error {
+	return s.ServeEndpoints(Endpoint{Listener: l})
+}
+
+// ServeTLS is like Serve but terminates TLS on the reactor.
+// The negotiated state is exposed on http.Request.TLS.
+// The reactor collects the ClientHello without tying up a goroutine, but crypto/tls
+// cannot resume a partial handshake: the serving goroutine then blocks until the client
+// answers the server's flight, one round trip bounded by WithTLSHandshakeTimeout.
+// ServeTLS는 Serve와 같지만 리액터에서 TLS를 종료합니다.
+// 협상된 상태는 http.Request.TLS로 노출됩니다.
+func (s *Server) ServeTLS(addr string, config *tls.Config) error {
+	if err := checkTLSConfig(config); err != nil {
+		return err
+	}
+	return s.ServeEndpoints(Endpoint{Addr: addr, TLSConfig: config})
+}
+
+// ServeEndpoints binds every endpoint and serves them all with the same Engine.
+// Connection accounting (MaxConns) is shared, and Shutdown stops them together.
+// It blocks until all endpoints have stopped.
+// ServeEndpoints는 모든 엔드포인트를 바인딩하고 동일한 Engine으로 처리합니다.
+// 연결 수 제한(MaxConns)은 공유되며, Shutdown은 모두를 함께 종료합니다.
+func (s *Server) ServeEndpoints(endpoints ...Endpoint) error {
 	s.markStarted()
 	if s.shutdownRequested.Load() {
 		s.markReady()
+		for _, ep := range endpoints {
+			if ep.Listener != nil {
+				ep.Listener.Close()
+			}
+		}
 		return nil
 	}
 	if !s.serving.CompareAndSwap(false, true) {
@@ -116,33 +342,176 @@ func (s *Server) Serve(addr string) error {
 	}
 	defer s.serving.Store(false)
 
-	l, err := reuseport.Listen("tcp", addr)
-	if err != nil {
+	if len(endpoints) == 0 {
 		s.markReady()
-		return err
+		return ErrNoEndpoints
 	}
 
-	listener, err := netpoll.ConvertListener(l)
-	if err != nil {
+	bound := make([]*boundEndpoint, 0, len(endpoints))
+	fail := func(err error) error {
+		for _, b := range bound {
+			b.listener.Close()
+		}
 		s.markReady()
 		return err
 	}
 
-	log.Printf("Server listening on %s (MaxConns: %d)", addr, s.maxConns)
+	for _, ep := range endpoints {
+		if ep.TLSConfig != nil {
+			if err := checkTLSConfig(ep.TLSConfig); err != nil {
+				return fail(err)
+			}
+		}
+
+		b := &boundEndpoint{addr: ep.Addr, listener: ep.Listener, done: make(chan struct{})}
+		if b.listener != nil {
+			b.addr = listenerAddr(b.listener)
+		} else {
+			var err error
+			if b.listener, err = listen(ep.Addr); err != nil {
+				return fail(err)
+			}
+		}
+		bound = append(bound, b)
+
+		pl, err := netpoll.ConvertListener(b.listener)
+		if err != nil {
+			return fail(err)
+		}
+		b.pollListener = &endpointListener{Listener: pl}
+		// OnRequest callback invokes the Engine's ServeConn method.
+		// OnRequest 콜백은 Engine의 ServeConn 메서드를 호출합니다.
+		onRequest := s.Engine.ServeConn
+		if s.queueMax > 0 {
+			onRequest = s.serveQueued
+		}
+		if b.eventLoop, err = netpoll.NewEventLoop(onRequest, s.eventLoopOptions(tlsConfigFor(ep.TLSConfig))...); err != nil {
+			return fail(err)
+		}
+
+		s.logger.Info("server listening", "addr", b.addr, "max_conns", s.maxConns, "tls", ep.TLSConfig != nil)
+	}
+
+	s.mu.Lock()
+	s.endpoints = bound
+	s.mu.Unlock()
+	s.markReady()
+	for _, b := range bound {
+		markInheritedServing(b.listener)
+	}
+
+	errs := make(chan error, len(bound))
+	for _, b := range bound {
+		go func() {
+			defer close(b.done)
+			err := b.eventLoop.Serve(b.pollListener)
+			if b.pollListener.isStopped() {
+				// Shutdown stopped the listener; the loop quitting is not an error.
+				err = nil
+			}
+			errs <- err
+		}()
+	}
+	var err error
+	for range bound {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+// checkTLSConfig reports whether config can serve a handshake.
+func checkTLSConfig(config *tls.Config) error {
+	if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil) {
+		return ErrMissingCertificate
+	}
+	return nil
+}
+
+// tlsConfigFor returns a private copy of config advertising HTTP/1.1 via ALPN, or nil.
+func tlsConfigFor(config *tls.Config) *tls.Config {
+	if config == nil {
+		return nil
+	}
+	config = config.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config
+}
+
+// listen binds addr, treating the "unix://" scheme as a Unix domain socket path.
+// A listener inherited from an upgrading parent is reused when available, and a stale
+// socket file left by a crashed process is removed before binding.
+// listen은 addr에 바인딩하며, "unix://" 스킴은 Unix 도메인 소켓 경로로 처리합니다.
+func listen(addr string) (net.Listener, error) {
+	if l, ok := InheritedListener(addr); ok {
+		return l, nil
+	}
+	path, ok := strings.CutPrefix(addr, unixScheme)
+	if !ok {
+		return reuseport.Listen("tcp", addr)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+		} else {
+			_ = os.Remove(path)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// listenerAddr returns the address Serve would be given to bind l, so a listener passed
+// to ServeListener is handed over on Upgrade under the key the new process looks up.
+func listenerAddr(l net.Listener) string {
+	addr := l.Addr()
+	if addr.Network() == "unix" {
+		return unixScheme + addr.String()
+	}
+	return addr.String()
+}
 
-	opts := []netpoll.Option{
+// eventLoopOptions builds the netpoll callbacks shared by every endpoint.
+// Only the TLS configuration differs between endpoints.
+func (s *Server) eventLoopOptions(tlsConfig *tls.Config) []netpoll.Option {
+	return []netpoll.Option{
 		netpoll.WithIdleTimeout(s.keepAliveTimeout),
 		netpoll.WithOnPrepare(func(conn netpoll.Connection) context.Context {
+			isTLS := tlsConfig != nil
+
+			// Per-client limits and accept rates
+			ip, hasIP := clientIP(conn.RemoteAddr())
+			limited := s.limits.enabled()
+			if limited {
+				if reason, ok := s.limits.admit(ip, hasIP, time.Now()); !ok {
+					s.reject(conn, reason, isTLS)
+					return nil
+				}
+			}
+			releaseLimits := func() {
+				if limited && hasIP {
+					s.limits.release(ip)
+				}
+			}
+
 			// Connection Limiter
-			current := atomic.AddInt32(&s.connsCount, 1)
-			if s.maxConns > 0 && current > s.maxConns {
-				atomic.AddInt32(&s.connsCount, -1)
-				conn.Close()
-				return nil
+			var w *waiter
+			if !s.acquireConn() {
+				if s.queueMax == 0 {
+					releaseLimits()
+					s.overloaded(conn, isTLS)
+					return nil
+				}
+				w = &waiter{conn: conn, isTLS: isTLS, done: make(chan struct{})}
 			}
 
 			if err := conn.SetReadTimeout(s.readTimeout); err != nil {
-				log.Printf("Failed to set read timeout: %v. Closing connection.", err)
+				s.logger.Warn("failed to set read timeout, closing connection",
+					"remote_addr", conn.RemoteAddr(), "error", err)
+				if w == nil {
+					s.releaseConn()
+				}
+				releaseLimits()
 				conn.Close()
 				return nil
 			}
@@ -153,54 +522,145 @@ func (s *Server) Serve(addr string) error {
 			// Optimization: Use ConnectionState as Context directly (Zero-Alloc)
 			// ConnectionState implements context.Context and manages its own cancellation.
 			state := engine.NewConnectionState(s.readTimeout)
-			return state
+			s.Engine.PrepareConn(conn, state)
+			if isTLS {
+				state.TLS = engine.NewTLSConn(conn, tlsConfig)
+				if s.handshakeTimeout > 0 {
+					state.TLS.SetHandshakeTimeout(s.handshakeTimeout)
+				}
+			}
+			state.ProxyMode = s.proxyModeFor(conn.RemoteAddr())
+
+			var ctx context.Context = state
+			if w != nil {
+				w.ConnectionState = state
+				if !s.enqueue(w) {
+					s.Engine.ReleaseConnectionState(state)
+					releaseLimits()
+					s.overloaded(conn, isTLS)
+					return nil
+				}
+				ctx = w
+			}
+			s.acceptedConns.Add(1)
+			s.trackConn(state, conn, true)
+			s.Engine.ReportConnState(connOf(state, conn), state, http.StateNew)
+
+			// OnDisconnect only fires when the peer hangs up, so accounting and
+			// release happen in a close callback, which runs however the connection ends.
+			conn.AddCloseCallback(func(connection netpoll.Connection) error {
+				if w != nil {
+					s.closeWaiter(w)
+				} else {
+					s.releaseConn()
+				}
+				releaseLimits()
+				s.trackConn(state, connection, false)
+				s.Engine.ReportConnState(connOf(state, connection), state, http.StateClosed)
+				state.Cancel()
+
+				// Return buffers to the Engine's pool and state to global pool
+				s.Engine.ReleaseConnectionState(state)
+				return nil
+			})
+			return ctx
 		}),
 		netpoll.WithOnDisconnect(func(ctx context.Context, connection netpoll.Connection) {
-			// Decrement connection count
-			atomic.AddInt32(&s.connsCount, -1)
-
-			// Retrieve and release ConnectionState resources
 			// ConnectionState is the context itself
 			state, ok := ctx.(*engine.ConnectionState)
 			if !ok {
 				// Fallback if context was wrapped or something unexpected
 				val := ctx.Value(engine.CtxKeyConnectionState)
 				if val == nil {
-					log.Printf("Warning: ConnectionState not found in context during disconnect")
+					s.logger.Warn("connection state not found in context during disconnect")
 					return
 				}
 				state, ok = val.(*engine.ConnectionState)
 				if !ok {
-					log.Printf("Warning: Invalid ConnectionState type in context during disconnect")
+					s.logger.Warn("invalid connection state type in context during disconnect")
 					return
 				}
 			}
 
-			state.Cancel() // Cancels context on connection disconnect.
-
-			// Return buffers to the Engine's pool and state to global pool
-			s.Engine.ReleaseConnectionState(state)
+			// Cancel context as soon as the peer hangs up so in-flight handlers can stop.
+			// Resources are released by the close callback registered in OnPrepare.
+			state.Cancel()
 		}),
 	}
+}
 
-	// OnRequest callback invokes the Engine's ServeConn method.
-	// OnRequest 콜백은 Engine의 ServeConn 메서드를 호출합니다.
-	eventLoop, err := netpoll.NewEventLoop(s.Engine.ServeConn, opts...)
-	if err != nil {
-		s.markReady()
-		return err
+// proxyModeFor returns the PROXY protocol mode for a peer, honoring the trusted list.
+func (s *Server) proxyModeFor(addr net.Addr) proxyproto.Mode {
+	if s.proxyMode == proxyproto.Off || len(s.proxyTrusted) == 0 {
+		return s.proxyMode
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return proxyproto.Off
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return proxyproto.Off
+	}
+	ip = ip.Unmap()
+	for _, p := range s.proxyTrusted {
+		if p.Contains(ip) {
+			return s.proxyMode
+		}
 	}
+	return proxyproto.Off
+}
 
-	s.mu.Lock()
-	s.eventLoop = eventLoop
-	s.mu.Unlock()
-	s.markReady()
+// trackConn adds or removes a connection from the drain set.
+func (s *Server) trackConn(state *engine.ConnectionState, conn netpoll.Connection, add bool) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if add {
+		if s.draining.Load() {
+			state.Draining.Store(true)
+		}
+		s.conns[state] = conn
+	} else {
+		delete(s.conns, state)
+	}
+}
+
+// connOf returns the net.Conn handlers see for a connection: the TLS wrapper when
+// the connection is served over TLS, the raw connection otherwise.
+func connOf(state *engine.ConnectionState, conn netpoll.Connection) net.Conn {
+	if state.TLS != nil {
+		return state.TLS
+	}
+	return conn
+}
 
-	return eventLoop.Serve(listener)
+// forEachConn calls fn for a snapshot of the live connections.
+func (s *Server) forEachConn(fn func(state *engine.ConnectionState, conn net.Conn)) {
+	s.connsMu.Lock()
+	type entry struct {
+		state *engine.ConnectionState
+		conn  net.Conn
+	}
+	snapshot := make([]entry, 0, len(s.conns))
+	for state, conn := range s.conns {
+		snapshot = append(snapshot, entry{state, connOf(state, conn)})
+	}
+	s.connsMu.Unlock()
+
+	for _, e := range snapshot {
+		fn(e.state, e.conn)
+	}
 }
 
 // Shutdown gracefully shuts down the server.
+// It stops accepting, marks in-flight responses with "Connection: close", closes idle
+// keep-alive connections immediately and waits for active handlers until ctx is done.
+// Hijacked connections are passed to the WithOnShutdownHijacked hook first, and h2c
+// connections are sent GOAWAY so they close once their streams finish.
+// Connections still open when ctx expires are force-closed and ctx.Err() is returned.
 // Shutdown은 서버를 정상적으로(gracefully) 종료합니다.
+// 새 연결 수락을 중단하고, 처리 중인 응답에 "Connection: close"를 표시하며, 유휴 연결은 즉시 닫고
+// ctx가 끝날 때까지 활성 핸들러를 기다립니다. 하이재킹된 연결은 먼저 훅으로 전달됩니다.
 func (s *Server) Shutdown(ctx context.Context) error {
 	select {
 	case <-s.started:
@@ -216,10 +676,72 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	}
 
 	s.mu.RLock()
-	eventLoop := s.eventLoop
+	endpoints := s.endpoints
 	s.mu.RUnlock()
-	if eventLoop == nil {
+	if len(endpoints) == 0 {
 		return nil
 	}
-	return eventLoop.Shutdown(ctx)
+
+	s.connsMu.Lock()
+	s.draining.Store(true)
+	for state := range s.conns {
+		state.Draining.Store(true)
+	}
+	s.connsMu.Unlock()
+	s.flushQueue()
+
+	// No new connections are accepted while the ones already open drain.
+	var stopping sync.WaitGroup
+	for _, b := range endpoints {
+		stopping.Add(1)
+		go func() {
+			defer stopping.Done()
+			b.stopAccepting(ctx)
+		}()
+	}
+	stopping.Wait()
+
+	// netpoll does not see the streams running on h2c connections; ask this server's
+	// connections to wind down and wait for their streams before it closes them.
+	var goAways []<-chan struct{}
+	s.forEachConn(func(state *engine.ConnectionState, _ net.Conn) {
+		if done := s.Engine.GoAway(state); done != nil {
+			goAways = append(goAways, done)
+		}
+	})
+	for _, done := range goAways {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
+	if s.onShutdownHijacked != nil {
+		s.forEachConn(func(state *engine.ConnectionState, conn net.Conn) {
+			if state.Hijacked.Load() {
+				s.onShutdownHijacked(conn)
+			}
+		})
+	}
+
+	// netpoll closes connections that are not being processed and waits for the ones
+	// that are (i.e. running handlers).
+	errs := make(chan error, len(endpoints))
+	for _, b := range endpoints {
+		go func() {
+			errs <- b.shutdown(ctx)
+		}()
+	}
+	var err error
+	for range endpoints {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		s.forEachConn(func(_ *engine.ConnectionState, conn net.Conn) {
+			conn.Close()
+		})
+	}
+	return err
 }
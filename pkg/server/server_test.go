@@ -1,15 +1,39 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/DevNewbie1826/hon/pkg/adaptor"
 	"github.com/DevNewbie1826/hon/pkg/engine"
+	"github.com/DevNewbie1826/hon/pkg/engine/proxyproto"
+	"github.com/DevNewbie1826/hon/pkg/logging"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
 )
 
 func TestServer_ServeAndShutdown(t *testing.T) {
@@ -264,3 +288,1980 @@ func TestServer_ConcurrentServeReturnsError(t *testing.T) {
 		t.Fatal("first Serve did not exit after Shutdown")
 	}
 }
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hon.test"},
+		DNSNames:     []string{"hon.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func TestServer_ServeTLS(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "no tls state", http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.TLS.ServerName + ":" + string(body)))
+	})
+	srv := NewServer(engine.NewEngine(mux), WithReadTimeout(time.Second))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeTLS(":19993", newTestTLSConfig(t))
+	}()
+
+	var conn *tls.Conn
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c, err := tls.Dial("tcp", "127.0.0.1:19993", &tls.Config{ServerName: "hon.test", InsecureSkipVerify: true})
+		if err == nil {
+			conn = c
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatal("failed to establish TLS connection")
+	}
+	defer conn.Close()
+
+	if got := conn.ConnectionState().NegotiatedProtocol; got != "" && got != "http/1.1" {
+		t.Fatalf("unexpected ALPN protocol %q", got)
+	}
+
+	// Two requests on the same connection exercise keep-alive over the TLS record layer.
+	br := bufio.NewReader(conn)
+	for _, body := range []string{"one", "two"} {
+		req := "POST / HTTP/1.1\r\nHost: hon.test\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+		if _, err := conn.Write([]byte(req)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("ReadResponse failed: %v", err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(got) != "hon.test:"+body {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, got)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	<-done
+}
+
+func TestServer_ServeTLS_HandshakeTimeout(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	srv := NewServer(engine.NewEngine(mux), WithTLSHandshakeTimeout(200*time.Millisecond))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	config := newTestTLSConfig(t)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeEndpoints(Endpoint{Listener: l, TLSConfig: config})
+	}()
+	<-srv.ready
+	addr := l.Addr().String()
+
+	// Capture a real ClientHello and send only part of it.
+	client, server := net.Pipe()
+	go tls.Client(client, &tls.Config{ServerName: "hon.test", InsecureSkipVerify: true}).Handshake()
+	hello := make([]byte, 64)
+	if _, err := io.ReadFull(server, hello); err != nil {
+		t.Fatalf("reading ClientHello failed: %v", err)
+	}
+	client.Close()
+
+	stalled, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer stalled.Close()
+	if _, err := stalled.Write(hello); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// Other clients are served while the stalled handshake waits.
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "hon.test", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("handshake failed next to a stalled one: %v", err)
+	}
+	conn.Close()
+
+	start := time.Now()
+	_ = stalled.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := stalled.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the stalled handshake to be closed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stalled handshake closed after %v", elapsed)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	<-done
+}
+
+func TestServer_ServeTLS_MissingCertificate(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()))
+	if err := srv.ServeTLS(":19992", &tls.Config{}); !errors.Is(err, ErrMissingCertificate) {
+		t.Fatalf("expected ErrMissingCertificate, got %v", err)
+	}
+}
+
+func TestServer_ServeListener(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("listener"))
+	})
+	srv := NewServer(engine.NewEngine(mux))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "listener" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	<-done
+}
+
+func TestServer_ServeUnixSocket(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unix"))
+	})
+	srv := NewServer(engine.NewEngine(mux))
+
+	path := filepath.Join(t.TempDir(), "hon.sock")
+
+	// Leave a stale socket file behind, as a crashed process would.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve("unix://" + path)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+
+	var resp *http.Response
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err = client.Get("http://unix/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over unix socket failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "unix" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	<-done
+}
+
+func TestServer_Shutdown_DrainsActiveHandlers(t *testing.T) {
+	mux := http.NewServeMux()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.Write([]byte("done"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := NewServer(engine.NewEngine(mux))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	addr := l.Addr().String()
+
+	// Idle keep-alive connection.
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer idle.Close()
+	idle.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	idleReader := bufio.NewReader(idle)
+	if resp, err := http.ReadResponse(idleReader, nil); err != nil {
+		t.Fatalf("idle request failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// Active connection with a handler in flight.
+	active, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer active.Close()
+	active.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-entered
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idleReader.ReadByte(); err == nil {
+		t.Fatal("idle keep-alive connection should be closed by Shutdown")
+	}
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the active handler finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	resp, err := http.ReadResponse(bufio.NewReader(active), nil)
+	if err != nil {
+		t.Fatalf("active request failed: %v", err)
+	}
+	resp.Body.Close()
+	if !resp.Close {
+		t.Error("in-flight response should carry Connection: close")
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	<-done
+}
+
+func TestServer_Shutdown_NotifiesHijackedConnections(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		hj := w.(adaptor.Hijacker)
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		hj.SetReadHandler(func(c net.Conn, rw *bufio.ReadWriter) error {
+			_, err := rw.Discard(rw.Reader.Buffered())
+			return err
+		})
+		_ = conn
+	})
+
+	notified := make(chan struct{}, 1)
+	srv := NewServer(engine.NewEngine(mux), WithOnShutdownHijacked(func(conn net.Conn) {
+		conn.Write([]byte("going away"))
+		notified <- struct{}{}
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case <-notified:
+	default:
+		t.Fatal("hijacked connection was not notified")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	rest, _ := io.ReadAll(br)
+	if string(rest) != "going away" {
+		t.Fatalf("expected notification before close, got %q", rest)
+	}
+	<-done
+}
+
+// TestUpgradeHelperProcess is the child side of TestServer_Upgrade; it is a no-op
+// unless started by that test.
+func TestUpgradeHelperProcess(t *testing.T) {
+	if os.Getenv("HON_TEST_UPGRADE_HANG") != "" {
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+	addr := os.Getenv("HON_TEST_UPGRADE_ADDR")
+	if addr == "" {
+		return
+	}
+	if _, ok := InheritedListener(addr); !ok {
+		os.Exit(2)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("child"))
+	})
+	_ = NewServer(engine.NewEngine(mux)).Serve(addr)
+	os.Exit(0)
+}
+
+func TestServer_Upgrade(t *testing.T) {
+	const addr = "127.0.0.1:0"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("parent"))
+	})
+
+	var child *exec.Cmd
+	srv := NewServer(engine.NewEngine(mux), WithUpgradeCommand(func() (*exec.Cmd, error) {
+		child = exec.Command(os.Args[0], "-test.run=^TestUpgradeHelperProcess$")
+		child.Env = append(os.Environ(), "HON_TEST_UPGRADE_ADDR="+addr)
+		return child, nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(addr)
+	}()
+	<-srv.ready
+
+	srv.mu.RLock()
+	url := "http://" + srv.endpoints[0].listener.Addr().String() + "/"
+	srv.mu.RUnlock()
+
+	get := func() string {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := get(); got != "parent" {
+		t.Fatalf("expected parent response, got %q", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Upgrade(ctx); err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	defer func() {
+		child.Process.Kill()
+		child.Wait()
+	}()
+	<-done
+
+	if got := get(); got != "child" {
+		t.Fatalf("expected child response after upgrade, got %q", got)
+	}
+}
+
+// TestServer_Upgrade_UnixListener checks that a Unix socket passed to ServeListener is
+// handed to a child that serves the "unix://" form of its address.
+func TestServer_Upgrade_UnixListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hon.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("parent"))
+	})
+	var child *exec.Cmd
+	srv := NewServer(engine.NewEngine(mux), WithUpgradeCommand(func() (*exec.Cmd, error) {
+		child = exec.Command(os.Args[0], "-test.run=^TestUpgradeHelperProcess$")
+		child.Env = append(os.Environ(), "HON_TEST_UPGRADE_ADDR="+unixScheme+path)
+		return child, nil
+	}))
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	<-srv.ready
+
+	get := func() string {
+		client := &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+		resp, err := client.Get("http://unix/")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if got := get(); got != "parent" {
+		t.Fatalf("expected parent response, got %q", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Upgrade(ctx); err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	defer func() {
+		child.Process.Kill()
+		child.Wait()
+	}()
+	<-done
+
+	if got := get(); got != "child" {
+		t.Fatalf("expected child response after upgrade, got %q", got)
+	}
+}
+
+func TestServer_Upgrade_ChildFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		timeout time.Duration
+		want    error
+	}{
+		{"exits before ready", "", 5 * time.Second, ErrUpgradeChildExited},
+		{"never ready", "HON_TEST_UPGRADE_HANG=1", 200 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hon.sock")
+			var child *exec.Cmd
+			srv := NewServer(engine.NewEngine(http.NewServeMux()), WithUpgradeCommand(func() (*exec.Cmd, error) {
+				child = exec.Command(os.Args[0], "-test.run=^TestUpgradeHelperProcess$")
+				child.Env = append(os.Environ(), tt.env)
+				return child, nil
+			}))
+			done := make(chan error, 1)
+			go func() {
+				done <- srv.Serve(unixScheme + path)
+			}()
+			<-srv.ready
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := srv.Upgrade(ctx); !errors.Is(err, tt.want) {
+				t.Fatalf("Upgrade error = %v, want %v", err, tt.want)
+			}
+			if child.ProcessState == nil {
+				t.Fatal("the failed child was not waited for")
+			}
+
+			// The parent keeps serving and still owns the socket file.
+			if err := srv.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown failed: %v", err)
+			}
+			<-done
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("expected the socket file to be removed on shutdown, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_Upgrade_NotServing(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()))
+	if err := srv.Upgrade(context.Background()); !errors.Is(err, ErrNotServing) {
+		t.Fatalf("expected ErrNotServing, got %v", err)
+	}
+}
+
+func TestServer_ServeEndpoints_SharesConnsAndShutdown(t *testing.T) {
+	mux := http.NewServeMux()
+	blocked := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-blocked
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := NewServer(engine.NewEngine(mux), WithMaxConns(1))
+
+	public, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	admin, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "hon.sock")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeEndpoints(
+			Endpoint{Listener: public},
+			Endpoint{Listener: admin},
+			Endpoint{Addr: "unix://" + path},
+		)
+	}()
+	<-srv.ready
+
+	conn1, err := net.Dial("tcp", public.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn1.Close()
+	conn1.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	<-entered
+
+	// The limit is shared, so a connection on another endpoint is rejected.
+	conn2, err := net.Dial("tcp", admin.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected second endpoint connection to be rejected by shared MaxConns")
+	}
+	if got := atomic.LoadInt32(&srv.connsCount); got != 1 {
+		t.Fatalf("expected shared connection count 1, got %d", got)
+	}
+
+	close(blocked)
+	if _, err := http.ReadResponse(bufio.NewReader(conn1), nil); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ServeEndpoints returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeEndpoints did not return after Shutdown")
+	}
+
+	for _, addr := range []string{public.Addr().String(), admin.Addr().String()} {
+		if c, err := net.DialTimeout("tcp", addr, 50*time.Millisecond); err == nil {
+			c.Close()
+			t.Fatalf("endpoint %s still accepting after Shutdown", addr)
+		}
+	}
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		t.Fatal("unix endpoint still accepting after Shutdown")
+	}
+}
+
+func TestServer_ServeEndpoints_Empty(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()))
+	if err := srv.ServeEndpoints(); !errors.Is(err, ErrNoEndpoints) {
+		t.Fatalf("expected ErrNoEndpoints, got %v", err)
+	}
+}
+
+func TestServer_ProxyProtocol(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		authority := ""
+		if h := engine.ProxyHeader(r.Context()); h != nil {
+			authority = h.Authority()
+		}
+		w.Write([]byte(r.RemoteAddr + " " + local.String() + " " + authority))
+	})
+	srv := NewServer(engine.NewEngine(mux),
+		WithProxyProtocol(proxyproto.Required, netip.MustParsePrefix("127.0.0.0/8")))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+		<-done
+	}()
+
+	roundTrip := func(header []byte) (string, error) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Write(append(header, "GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"...)); err != nil {
+			return "", err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := roundTrip([]byte("PROXY TCP4 192.0.2.1 198.51.100.2 56324 443\r\n"))
+	if err != nil {
+		t.Fatalf("v1 request failed: %v", err)
+	}
+	if body != "192.0.2.1:56324 198.51.100.2:443 " {
+		t.Fatalf("unexpected v1 body %q", body)
+	}
+
+	v2 := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x1a")
+	v2 = append(v2, 10, 0, 0, 1, 10, 0, 0, 2, 0x0f, 0xa0, 0x20, 0xfb)
+	v2 = append(v2, proxyproto.TypeAuthority, 0, 11)
+	v2 = append(v2, "example.com"...)
+	body, err = roundTrip(v2)
+	if err != nil {
+		t.Fatalf("v2 request failed: %v", err)
+	}
+	if body != "10.0.0.1:4000 10.0.0.2:8443 example.com" {
+		t.Fatalf("unexpected v2 body %q", body)
+	}
+
+	if _, err := roundTrip(nil); err == nil {
+		t.Fatal("expected connection without a PROXY header to be closed")
+	}
+}
+
+func TestServer_ConnsCountReleasedOnServerClose(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&srv.connsCount) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected connection count to return to 0, got %d", atomic.LoadInt32(&srv.connsCount))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_MaxConnsPerIP(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()),
+		WithMaxConnsPerIP(1), WithRejectAction(RejectTooManyRequests))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	// Make sure the first connection has been accepted before opening the second.
+	conn1.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	r1 := bufio.NewReader(conn1)
+	if resp, err := http.ReadResponse(r1, nil); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn2), nil)
+	if err != nil {
+		t.Fatalf("expected 429 on second connection, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+	if got := srv.RejectedConns().PerIP; got != 1 {
+		t.Fatalf("expected 1 per-IP rejection, got %d", got)
+	}
+
+	// Closing the first connection frees the slot.
+	conn1.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn3, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		conn3.SetDeadline(time.Now().Add(time.Second))
+		conn3.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+		resp, err := http.ReadResponse(bufio.NewReader(conn3), nil)
+		conn3.Close()
+		if err == nil && resp.StatusCode == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot was not released after the first connection closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServer_AcceptRatePerIP(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()), WithAcceptRatePerIP(0.001, 2))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	var ok int
+	for i := 0; i < 4; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+		if resp, err := http.ReadResponse(bufio.NewReader(conn), nil); err == nil {
+			resp.Body.Close()
+			ok++
+		}
+		conn.Close()
+	}
+	if ok != 2 {
+		t.Fatalf("expected burst of 2 accepted connections, got %d", ok)
+	}
+	if got := srv.RejectedConns().Rate; got != 2 {
+		t.Fatalf("expected 2 rate rejections, got %d", got)
+	}
+}
+
+func TestServer_MaxConns_OverloadResponse(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()),
+		WithMaxConns(1), WithOverloadResponse(1500*time.Millisecond))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn1.Close()
+	conn1.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	if resp, err := http.ReadResponse(bufio.NewReader(conn1), nil); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn2), nil)
+	if err != nil {
+		t.Fatalf("expected 503, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", got)
+	}
+	if got := srv.RejectedConns().MaxConns; got != 1 {
+		t.Fatalf("expected 1 MaxConns rejection, got %d", got)
+	}
+}
+
+func TestServer_MaxConns_OverloadQueue(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()),
+		WithMaxConns(1), WithOverloadQueue(2*time.Second, 1), WithOverloadResponse(0))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	dialAndSend := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+		return conn, bufio.NewReader(conn)
+	}
+
+	conn1, r1 := dialAndSend()
+	defer conn1.Close()
+	if resp, err := http.ReadResponse(r1, nil); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// The second connection waits in the queue; the third overflows it.
+	conn2, r2 := dialAndSend()
+	defer conn2.Close()
+	time.Sleep(50 * time.Millisecond)
+	conn3, r3 := dialAndSend()
+	defer conn3.Close()
+	if resp, err := http.ReadResponse(r3, nil); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for queue overflow, got %v %v", resp, err)
+	}
+
+	queued := make(chan int, 1)
+	go func() {
+		resp, err := http.ReadResponse(r2, nil)
+		if err != nil {
+			queued <- 0
+			return
+		}
+		resp.Body.Close()
+		queued <- resp.StatusCode
+	}()
+
+	select {
+	case code := <-queued:
+		t.Fatalf("queued connection served before capacity freed (status %d)", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conn1.Close()
+	if code := <-queued; code != http.StatusNotFound {
+		t.Fatalf("expected queued connection to be served, got status %d", code)
+	}
+}
+
+func TestServer_MaxConns_OverloadQueueTimeout(t *testing.T) {
+	srv := NewServer(engine.NewEngine(http.NewServeMux()),
+		WithMaxConns(1), WithOverloadQueue(50*time.Millisecond, 4), WithOverloadResponse(time.Second))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn1.Close()
+	conn1.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	if resp, err := http.ReadResponse(bufio.NewReader(conn1), nil); err != nil {
+		t.Fatalf("first request failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn2.Close()
+	conn2.SetDeadline(time.Now().Add(2 * time.Second))
+	conn2.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn2), nil)
+	if err != nil {
+		t.Fatalf("expected 503 after queue timeout, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Stats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/hijack", func(w http.ResponseWriter, r *http.Request) {
+		_, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		rw.Flush()
+	})
+	srv := NewServer(engine.NewEngine(mux))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	waitFor := func(desc string, cond func(Stats) bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for !cond(srv.Stats()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s: %+v", desc, srv.Stats())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	stats := srv.Stats()
+	if stats.ActiveConns != 1 || stats.TotalConns != 1 {
+		t.Fatalf("unexpected connection counts: %+v", stats)
+	}
+	if stats.Requests != 2 || stats.KeepAliveReuses != 1 {
+		t.Fatalf("unexpected request counts: %+v", stats)
+	}
+	if stats.BytesRead == 0 || stats.BytesWritten == 0 {
+		t.Fatalf("expected byte counters to advance: %+v", stats)
+	}
+
+	conn.Write([]byte("GET /hijack HTTP/1.1\r\nHost: x\r\n\r\n"))
+	if resp, err := http.ReadResponse(r, nil); err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("hijack request failed: %v", err)
+	}
+	waitFor("active hijacked connection", func(s Stats) bool { return s.ActiveHijacked == 1 })
+
+	conn.Close()
+	waitFor("connection release", func(s Stats) bool { return s.ActiveConns == 0 && s.ActiveHijacked == 0 })
+}
+
+func TestServer_ConnStateLifecycle(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		states []http.ConnState
+		conns  = map[net.Conn]bool{}
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	eng := engine.NewEngine(mux, engine.WithConnState(func(c net.Conn, s http.ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, s)
+		conns[c] = true
+	}))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	if resp, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+		t.Fatalf("request failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	conn.Close()
+
+	want := []http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateClosed}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		got := fmt.Sprint(states)
+		n := len(conns)
+		mu.Unlock()
+		if got == fmt.Sprint(want) {
+			if n != 1 {
+				t.Fatalf("expected every transition to report the same net.Conn, got %d", n)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("states = %s, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_ReadHeaderTimeout(t *testing.T) {
+	eng := engine.NewEngine(http.NewServeMux(), engine.WithReadHeaderTimeout(200*time.Millisecond))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	// An idle keep-alive connection is not subject to the header timeout.
+	conn1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn1.Close()
+	conn1.SetDeadline(time.Now().Add(2 * time.Second))
+	r1 := bufio.NewReader(conn1)
+	for i := 0; i < 2; i++ {
+		conn1.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+		resp, err := http.ReadResponse(r1, nil)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+		time.Sleep(300 * time.Millisecond)
+	}
+
+	// A client dribbling its headers is cut off once the timeout elapses.
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn2.Close()
+	start := time.Now()
+	for _, b := range []byte("GET / HTTP/1.1\r\nHost: x\r\n") {
+		if _, err := conn2.Write([]byte{b}); err != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+		if time.Since(start) > 2*time.Second {
+			break
+		}
+	}
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn2.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the slow connection to be closed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("slow connection closed after %v, want about 200ms", elapsed)
+	}
+	if got := eng.Stats().ReadTimeouts; got != 1 {
+		t.Fatalf("expected 1 read timeout, got %d", got)
+	}
+}
+
+func TestServer_MinBodyRate(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, "%d", n)
+	})
+	eng := engine.NewEngine(mux, engine.WithMinBodyRate(1000, 200*time.Millisecond))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	// A body that arrives within the grace period is served.
+	conn1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn1.Close()
+	conn1.SetDeadline(time.Now().Add(2 * time.Second))
+	conn1.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\nhello"))
+	time.Sleep(50 * time.Millisecond)
+	conn1.Write([]byte("world"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn1), nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "10" {
+		t.Fatalf("expected body length 10, got %q", body)
+	}
+
+	// A stalled body is cut off once it falls behind the minimum rate.
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn2.Close()
+	start := time.Now()
+	conn2.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 100000\r\n\r\n0123456789"))
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn2.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the stalled connection to be closed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("stalled connection closed after %v, want about 210ms", elapsed)
+	}
+}
+
+func TestServer_StreamingBody(t *testing.T) {
+	firstChunk := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(r.Body, buf); err != nil {
+			t.Errorf("reading first chunk: %v", err)
+			return
+		}
+		firstChunk <- string(buf)
+		rest, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%s%s", buf, rest)
+	})
+	eng := engine.NewEngine(mux, engine.WithStreamingBody(true), engine.WithMinBodyRate(1000, 300*time.Millisecond))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	r := bufio.NewReader(conn)
+
+	// The handler sees the start of a chunked body before the rest is sent.
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n"))
+	select {
+	case got := <-firstChunk:
+		if got != "hello" {
+			t.Fatalf("expected first chunk %q, got %q", "hello", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler was not called before the body was complete")
+	}
+	conn.Write([]byte("6\r\n world\r\n0\r\n\r\n"))
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello world" {
+		t.Fatalf("expected echoed body %q, got %q", "hello world", body)
+	}
+
+	// A client that stops sending mid-body is cut off by the minimum body rate.
+	start := time.Now()
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 100000\r\n\r\nhello"))
+	<-firstChunk
+	if _, err := http.ReadResponse(r, nil); err == nil {
+		t.Fatal("expected the stalled connection to be closed without a response")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("stalled connection closed after %v, want about 300ms", elapsed)
+	}
+}
+
+func TestServer_StreamingBody_Backpressure(t *testing.T) {
+	const total = 64 << 20
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1)
+		if _, err := io.ReadFull(r.Body, buf); err != nil {
+			t.Errorf("reading first byte: %v", err)
+			return
+		}
+		close(started)
+		<-release
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%d", n+1)
+	})
+	eng := engine.NewEngine(mux, engine.WithStreamingBody(true), engine.WithStreamingBodyBuffer(64<<10))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	defer func() {
+		_ = srv.Shutdown(context.Background())
+		<-done
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.(*net.TCPConn).SetWriteBuffer(64 << 10)
+	conn.SetDeadline(time.Now().Add(20 * time.Second))
+	unblock := sync.OnceFunc(func() { close(release) })
+	defer unblock()
+
+	var written atomic.Int64
+	sent := make(chan error, 1)
+	go func() {
+		if _, err := fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: %d\r\n\r\n", total); err != nil {
+			sent <- err
+			return
+		}
+		chunk := make([]byte, 32<<10)
+		for written.Load() < total {
+			n, err := conn.Write(chunk)
+			written.Add(int64(n))
+			if err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler was not called")
+	}
+	// While the handler is not reading, the server stops taking the upload once its
+	// buffer is full, leaving only what fits in the socket buffers outstanding.
+	time.Sleep(500 * time.Millisecond)
+	if n := written.Load(); n > 8<<20 {
+		t.Fatalf("client wrote %d bytes while the handler was stalled, want the upload held back", n)
+	}
+
+	unblock()
+	if err := <-sent; err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != strconv.Itoa(total) {
+		t.Fatalf("handler read %s bytes, want %d", body, total)
+	}
+}
+
+func TestServer_ExpectContinue(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	})
+	mux.HandleFunc("/refuse", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	for _, immediate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("immediate=%v", immediate), func(t *testing.T) {
+			srv := NewServer(engine.NewEngine(mux, engine.WithImmediateContinue(immediate)))
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen failed: %v", err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				done <- srv.ServeListener(l)
+			}()
+			defer func() {
+				_ = srv.Shutdown(context.Background())
+				<-done
+			}()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(3 * time.Second))
+			r := bufio.NewReader(conn)
+
+			// The body is only sent once the server asks for it.
+			conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+			line, err := r.ReadString('\n')
+			if err != nil || line != "HTTP/1.1 100 Continue\r\n" {
+				t.Fatalf("expected 100 Continue, got %q (%v)", line, err)
+			}
+			if blank, _ := r.ReadString('\n'); blank != "\r\n" {
+				t.Fatalf("expected end of interim response, got %q", blank)
+			}
+			conn.Write([]byte("hello"))
+			resp, err := http.ReadResponse(r, nil)
+			if err != nil {
+				t.Fatalf("upload failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+				t.Fatalf("expected 200 echoing the body, got %d %q", resp.StatusCode, body)
+			}
+			if immediate {
+				return
+			}
+
+			// A handler that refuses without reading gets its final status out before
+			// any body is sent, and the connection is not reused.
+			conn.Write([]byte("POST /refuse HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+			resp, err = http.ReadResponse(r, nil)
+			if err != nil {
+				t.Fatalf("refused request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized || !resp.Close {
+				t.Fatalf("expected 401 with Connection: close, got %d (close=%v)", resp.StatusCode, resp.Close)
+			}
+			if _, err := r.ReadByte(); err != io.EOF {
+				t.Fatalf("expected the connection to be closed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_H2C(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Proto, r.URL.Path)
+	})
+	srv := NewServer(engine.NewEngine(mux, engine.WithH2C(true)))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeListener(l)
+	}()
+	addr := l.Addr().String()
+
+	get := func(client *http.Client, path string) string {
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Errorf("GET %s failed: %v", path, err)
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// Prior knowledge: concurrent requests are multiplexed on one connection.
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	defer tr.CloseIdleConnections()
+	h2 := &http.Client{Transport: tr}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := "/prior/" + strconv.Itoa(i)
+			if got := get(h2, path); got != "HTTP/2.0 "+path {
+				t.Errorf("expected an HTTP/2 response for %s, got %q", path, got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// HTTP/1.1 is still served alongside.
+	if got := get(http.DefaultClient, "/h1"); got != "HTTP/1.1 /h1" {
+		t.Errorf("expected an HTTP/1.1 response, got %q", got)
+	}
+
+	// Upgrade: the upgrading request is answered as stream 1 over HTTP/2.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte("GET /upgraded HTTP/1.1\r\nHost: x\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAAP__\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "h2c" {
+		t.Fatalf("expected 101 Switching Protocols to h2c, got %v (%v)", resp, err)
+	}
+	conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, br)
+	framer.WriteSettings()
+	var status, body string
+	dec := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+		if f.Name == ":status" {
+			status = f.Value
+		}
+	})
+	for body == "" {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("reading frames: %v", err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.HeadersFrame:
+			if f.StreamID == 1 {
+				dec.Write(f.HeaderBlockFragment())
+			}
+		case *http2.DataFrame:
+			if f.StreamID == 1 {
+				body = string(f.Data())
+			}
+		}
+	}
+	if status != "200" || body != "HTTP/2.0 /upgraded" {
+		t.Errorf("expected stream 1 to answer the upgrade request, got %s %q", status, body)
+	}
+	conn.Close()
+
+	// Open HTTP/2 connections do not hold up a graceful shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	<-done
+	if got := srv.Stats().Requests; got != 12 {
+		t.Errorf("expected 12 requests counted, got %d", got)
+	}
+}
+
+func TestServer_H2C_Streams(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Received")
+		n, _ := io.Copy(w, r.Body)
+		w.Header().Set("X-Received", strconv.FormatInt(n, 10))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		fmt.Fprint(w, r.Context().Err())
+	})
+	eng := engine.NewEngine(mux, engine.WithH2C(true),
+		engine.WithRequestTimeout(100*time.Millisecond), engine.WithLogger(logging.Discard()))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go srv.ServeListener(l)
+	defer srv.Shutdown(context.Background())
+	base := "http://" + l.Addr().String()
+
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr}
+
+	// Bodies larger than both flow control windows, in both directions, on concurrent streams.
+	const size = 3 << 20
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := strings.Repeat(strconv.Itoa(i), size)
+			resp, err := client.Post(base+"/echo", "text/plain", strings.NewReader(body))
+			if err != nil {
+				t.Errorf("POST failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil || string(got) != body {
+				t.Errorf("expected the body echoed, got %d bytes (%v)", len(got), err)
+			}
+			if n := resp.Trailer.Get("X-Received"); n != strconv.Itoa(size) {
+				t.Errorf("expected trailer X-Received: %d, got %q", size, n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp, err := client.Get(base + "/panic")
+	if err != nil {
+		t.Fatalf("GET /panic failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500 after a panic, got %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get(base + "/slow")
+	if err != nil {
+		t.Fatalf("GET /slow failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != context.DeadlineExceeded.Error() {
+		t.Errorf("expected the request timeout to apply, got %q", body)
+	}
+
+	stats := srv.Stats()
+	if stats.Requests != 6 || stats.HandlerPanics != 1 {
+		t.Errorf("expected 6 requests and 1 panic, got %d and %d", stats.Requests, stats.HandlerPanics)
+	}
+	if stats.RequestDuration.Count != 5 || stats.RequestSize.Count != 5 {
+		t.Errorf("expected 5 completed requests observed, got %d durations and %d sizes",
+			stats.RequestDuration.Count, stats.RequestSize.Count)
+	}
+
+	// Idle HTTP/2 connections wait on the reactor, not on goroutines of their own.
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte(http2.ClientPreface))
+		framer := http2.NewFramer(conn, conn)
+		framer.WriteSettings()
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		if f, err := framer.ReadFrame(); err != nil {
+			t.Fatalf("expected the server's SETTINGS, got %v", err)
+		} else if _, ok := f.(*http2.SettingsFrame); !ok {
+			t.Fatalf("expected the server's SETTINGS, got %v", f)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if grown := runtime.NumGoroutine() - before; grown > 10 {
+		t.Errorf("expected idle HTTP/2 connections to hold no goroutines, %d more are running", grown)
+	}
+}
+
+func TestServer_H2C_StreamIDReuse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+	srv := NewServer(engine.NewEngine(mux, engine.WithH2C(true)))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go srv.ServeListener(l)
+	defer srv.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, conn)
+	framer.WriteSettings()
+	var hbuf bytes.Buffer
+	enc := hpack.NewEncoder(&hbuf)
+	request := func(id uint32, path string) {
+		hbuf.Reset()
+		for _, f := range []hpack.HeaderField{
+			{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "http"},
+			{Name: ":authority", Value: "x"}, {Name: ":path", Value: path},
+		} {
+			enc.WriteField(f)
+		}
+		framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID: id, BlockFragment: hbuf.Bytes(), EndStream: true, EndHeaders: true,
+		})
+	}
+
+	// Stream 3 is served; a request on stream 1 afterwards reuses a lower ID.
+	request(3, "/three")
+	var goAway *http2.GoAwayFrame
+	for goAway == nil {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("expected GOAWAY, got %v", err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.DataFrame:
+			if f.StreamID == 3 && f.StreamEnded() {
+				request(1, "/one")
+			}
+		case *http2.HeadersFrame:
+			if f.StreamID == 1 {
+				t.Fatal("expected the reused stream ID to be refused, got a response")
+			}
+		case *http2.GoAwayFrame:
+			goAway = f
+		}
+	}
+	if goAway.ErrCode != http2.ErrCodeProtocol || goAway.LastStreamID != 3 {
+		t.Errorf("expected GOAWAY PROTOCOL_ERROR after stream 3, got %v after %d", goAway.ErrCode, goAway.LastStreamID)
+	}
+}
+
+func TestServer_H2C_SetMaxRequestBodySize(t *testing.T) {
+	// Both handlers set their limit before either reads, so a limit shared by the
+	// connection's streams would be seen by the wrong one.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/limit/{n}", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.ParseInt(r.PathValue("n"), 10, 64)
+		if !engine.SetMaxRequestBodySize(r.Context(), n) {
+			t.Errorf("SetMaxRequestBodySize(%d) reported no body", n)
+		}
+		arrived.Done()
+		arrived.Wait()
+		body, err := io.ReadAll(r.Body)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		fmt.Fprint(w, len(body))
+	})
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, engine.SetMaxRequestBodySize(r.Context(), 1<<20))
+	})
+	eng := engine.NewEngine(mux, engine.WithH2C(true), engine.WithMaxRequestBodySize(16))
+	srv := NewServer(eng)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go srv.ServeListener(l)
+	defer srv.Shutdown(context.Background())
+	base := "http://" + l.Addr().String()
+
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr, Timeout: 5 * time.Second}
+
+	resp, err := client.Get(base + "/get")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(got) != "false" {
+		t.Errorf("expected SetMaxRequestBodySize to report false without a body, got %s", got)
+	}
+
+	// Bodies of unknown length, so the route's limit is not applied up front.
+	body := strings.Repeat("x", 64)
+	want := map[string]string{"/limit/8": "413 ", "/limit/1024": "200 64"}
+	var wg sync.WaitGroup
+	for path, expected := range want {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Post(base+path, "text/plain", io.MultiReader(strings.NewReader(body)))
+			if err != nil {
+				t.Errorf("POST %s failed: %v", path, err)
+				return
+			}
+			defer resp.Body.Close()
+			got, _ := io.ReadAll(resp.Body)
+			if resp.ProtoMajor != 2 || strconv.Itoa(resp.StatusCode)+" "+string(got) != expected {
+				t.Errorf("POST %s: expected %q over HTTP/2, got %d %q (%s)", path, expected, resp.StatusCode, got, resp.Proto)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestServer_H2C_ShutdownSharedEngine(t *testing.T) {
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	mux.HandleFunc("/wait", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, "done")
+	})
+	eng := engine.NewEngine(mux, engine.WithH2C(true))
+	serve := func() (*Server, string, chan error) {
+		srv := NewServer(eng)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- srv.ServeListener(l) }()
+		return srv, "http://" + l.Addr().String(), done
+	}
+	a, baseA, doneA := serve()
+	b, baseB, doneB := serve()
+
+	tr := &http.Transport{Protocols: new(http.Protocols)}
+	tr.Protocols.SetUnencryptedHTTP2(true)
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr}
+	get := func(url string) (string, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if got, err := get(baseB + "/"); err != nil || got != "HTTP/2.0" {
+		t.Fatalf("expected an HTTP/2 response from b, got %q (%v)", got, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown of b failed: %v", err)
+	}
+	<-doneB
+
+	// Shutting b down leaves a, on the same engine, serving HTTP/2.
+	if got, err := get(baseA + "/"); err != nil || got != "HTTP/2.0" {
+		t.Fatalf("expected an HTTP/2 response from a after b shut down, got %q (%v)", got, err)
+	}
+
+	// A stream in flight finishes before a's shutdown closes its connection.
+	result := make(chan string, 1)
+	go func() {
+		got, err := get(baseA + "/wait")
+		if err != nil {
+			got = err.Error()
+		}
+		result <- got
+	}()
+	time.Sleep(100 * time.Millisecond)
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- a.Shutdown(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+	// a stops listening before it waits for the stream.
+	if c, err := net.Dial("tcp", strings.TrimPrefix(baseA, "http://")); err == nil {
+		c.Close()
+		t.Error("expected a to refuse connections while it drains")
+	}
+	close(release)
+	if got := <-result; got != "done" {
+		t.Errorf("expected the in-flight stream to complete, got %q", got)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown of a failed: %v", err)
+	}
+	<-doneA
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/DevNewbie1826/hon/pkg/engine"
+)
+
+// Stats is a point-in-time snapshot of server and engine counters.
+// Stats는 서버와 엔진 카운터의 특정 시점 스냅샷입니다.
+type Stats struct {
+	ActiveConns   int64       // Connections currently holding a MaxConns slot. // 현재 활성 연결 수입니다.
+	QueuedConns   int         // Connections waiting in the overload queue.
+	TotalConns    uint64      // Connections accepted since the server started.
+	RejectedConns RejectStats // Connections refused at accept time, by reason.
+	engine.Stats              // Request-level counters, including active hijacked connections.
+}
+
+// Stats returns a snapshot of the server's counters. All counters are maintained
+// with atomics on the hot path; taking a snapshot does not block serving.
+// Stats는 서버 카운터의 스냅샷을 반환합니다.
+func (s *Server) Stats() Stats {
+	s.queueMu.Lock()
+	queued := len(s.queue)
+	s.queueMu.Unlock()
+	return Stats{
+		ActiveConns:   int64(atomic.LoadInt32(&s.connsCount)),
+		QueuedConns:   queued,
+		TotalConns:    s.acceptedConns.Load(),
+		RejectedConns: s.RejectedConns(),
+		Stats:         s.Engine.Stats(),
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variables used to hand listeners from a parent to its upgraded child.
+// 부모에서 업그레이드된 자식 프로세스로 리스너를 전달할 때 사용하는 환경 변수입니다.
+const (
+	envUpgradeAddrs   = "HON_UPGRADE_ADDRS"    // JSON list of inherited listen addresses and their descriptors.
+	envUpgradeReadyFD = "HON_UPGRADE_READY_FD" // Pipe the child writes to once it is serving.
+)
+
+var (
+	ErrNotServing          = errors.New("server: not serving")
+	ErrListenerNotFileable = errors.New("server: listener does not expose a file descriptor")
+	ErrUpgradeChildExited  = errors.New("server: upgraded process exited before becoming ready")
+)
+
+// WithUpgradeCommand overrides how Upgrade starts the new process.
+// The default re-executes os.Executable() with the current arguments and stdio.
+// Upgrade appends its own ExtraFiles and environment to the returned command.
+// WithUpgradeCommand는 Upgrade가 새 프로세스를 시작하는 방법을 재정의합니다.
+func WithUpgradeCommand(fn func() (*exec.Cmd, error)) Option {
+	return func(s *Server) {
+		s.upgradeCommand = fn
+	}
+}
+
+func defaultUpgradeCommand() (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// Upgrade performs a zero-downtime binary upgrade: it starts a new process with the
+// listening sockets inherited as file descriptors, waits until the child reports that
+// it is serving, then gracefully shuts this server down. ctx bounds both phases.
+// A child that exits or is not ready before ctx is done is killed and reaped, and this
+// server keeps serving. In the child, Serve/ServeTLS with the same address pick up the
+// inherited socket.
+// Upgrade는 무중단 바이너리 업그레이드를 수행합니다: 리스닝 소켓을 파일 디스크립터로 상속한
+// 새 프로세스를 시작하고, 자식이 준비되면 이 서버를 정상 종료합니다.
+func (s *Server) Upgrade(ctx context.Context) error {
+	s.mu.RLock()
+	endpoints := s.endpoints
+	s.mu.RUnlock()
+	if len(endpoints) == 0 {
+		return ErrNotServing
+	}
+
+	files := make([]*os.File, 0, len(endpoints))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, b := range endpoints {
+		fl, ok := b.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return ErrListenerNotFileable
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	// The child now owns the socket paths; closing our listeners must not unlink them.
+	// If the upgrade fails they are ours again.
+	setUnlink := func(unlink bool) {
+		for _, b := range endpoints {
+			if ul, ok := b.listener.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(unlink)
+			}
+		}
+	}
+	fail := func(err error) error {
+		setUnlink(true)
+		return err
+	}
+	setUnlink(false)
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fail(err)
+	}
+	defer readyR.Close()
+
+	newCmd := s.upgradeCommand
+	if newCmd == nil {
+		newCmd = defaultUpgradeCommand
+	}
+	cmd, err := newCmd()
+	if err != nil {
+		readyW.Close()
+		return fail(err)
+	}
+
+	// ExtraFiles[i] becomes descriptor 3+i in the child.
+	fds := make([]inheritedFD, len(endpoints))
+	for i, b := range endpoints {
+		fds[i] = inheritedFD{Addr: b.addr, FD: 3 + len(cmd.ExtraFiles) + i}
+	}
+	addrs, _ := json.Marshal(fds)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(withoutUpgradeEnv(cmd.Env),
+		envUpgradeAddrs+"="+string(addrs),
+		envUpgradeReadyFD+"="+strconv.Itoa(3+len(cmd.ExtraFiles)+len(files)),
+	)
+	cmd.ExtraFiles = append(append(cmd.ExtraFiles, files...), readyW)
+
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fail(err)
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		if _, err := readyR.Read(b[:]); err != nil {
+			if err == io.EOF {
+				err = ErrUpgradeChildExited
+			}
+			ready <- err
+			return
+		}
+		ready <- nil
+	}()
+
+	select {
+	case err = <-ready:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		// A child that is not serving must not linger on the shared sockets.
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fail(err)
+	}
+
+	return s.Shutdown(ctx)
+}
+
+// withoutUpgradeEnv drops stale handoff variables inherited from a previous upgrade.
+func withoutUpgradeEnv(env []string) []string {
+	out := env[:0:0]
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envUpgradeAddrs+"=") || strings.HasPrefix(kv, envUpgradeReadyFD+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
+
+// inheritedFD describes one listening socket handed to the child.
+type inheritedFD struct {
+	Addr string `json:"addr"`
+	FD   int    `json:"fd"`
+}
+
+// inherited holds the listeners passed in by a parent process during Upgrade.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+	pending   map[net.Listener]struct{}
+	ready     *os.File
+}
+
+func loadInherited() {
+	inherited.once.Do(func() {
+		raw := os.Getenv(envUpgradeAddrs)
+		if raw == "" {
+			return
+		}
+		var fds []inheritedFD
+		if err := json.Unmarshal([]byte(raw), &fds); err != nil {
+			// Inherited listeners are loaded before any Server exists, so the default logger is used.
+			slog.Warn("invalid inherited listener list", "env", envUpgradeAddrs, "error", err)
+			return
+		}
+
+		inherited.listeners = make(map[string]net.Listener, len(fds))
+		inherited.pending = make(map[net.Listener]struct{}, len(fds))
+		for _, ifd := range fds {
+			f := os.NewFile(uintptr(ifd.FD), ifd.Addr)
+			l, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				slog.Warn("failed to inherit listener", "addr", ifd.Addr, "error", err)
+				continue
+			}
+			inherited.listeners[ifd.Addr] = l
+			inherited.pending[l] = struct{}{}
+		}
+
+		if fd, err := strconv.Atoi(os.Getenv(envUpgradeReadyFD)); err == nil {
+			inherited.ready = os.NewFile(uintptr(fd), "upgrade-ready")
+		}
+		os.Unsetenv(envUpgradeAddrs)
+		os.Unsetenv(envUpgradeReadyFD)
+	})
+}
+
+// InheritedListener returns the listener handed over by an upgrading parent for addr,
+// if any. Serve and ServeTLS consult it automatically; use it with ServeListener when
+// binding sockets yourself. Unix domain sockets are keyed as "unix:///path", whether the
+// parent bound them with Serve or passed them to ServeListener.
+// InheritedListener는 업그레이드 중인 부모가 addr에 대해 전달한 리스너를 반환합니다.
+func InheritedListener(addr string) (net.Listener, bool) {
+	loadInherited()
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	l, ok := inherited.listeners[addr]
+	return l, ok
+}
+
+// markInheritedServing records that l is being served. Once every inherited listener
+// is served, the parent is told it can start draining.
+func markInheritedServing(l net.Listener) {
+	loadInherited()
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if _, ok := inherited.pending[l]; !ok {
+		return
+	}
+	delete(inherited.pending, l)
+	if len(inherited.pending) == 0 && inherited.ready != nil {
+		_, _ = inherited.ready.Write([]byte{1})
+		inherited.ready.Close()
+		inherited.ready = nil
+	}
+}
@@ -184,7 +184,9 @@ func (c *Client) Dial(u string, handler Handler, opts ...Option) error {
 			wrappedHandler.OnClose(connection, nil)
 			return nil
 		}
-		return ServeConn(connection, nil, wrappedHandler, cfg, assembler)
+		err := ServeConn(connection, nil, wrappedHandler, cfg, assembler)
+		cfg.logError(connection, err)
+		return err
 	})
 	if err != nil {
 		conn.Close()
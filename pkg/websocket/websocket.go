@@ -7,9 +7,11 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/DevNewbie1826/hon/pkg/adaptor"
 	"github.com/cloudwego/netpoll"
@@ -41,6 +43,7 @@ type Config struct {
 	Header            http.Header
 	Cookies           []*http.Cookie
 	EnableCompression bool
+	Logger            *slog.Logger // Receives frame and protocol errors at debug level; nil means slog.Default().
 }
 
 type Option func(*Config)
@@ -51,6 +54,26 @@ func WithEnableCompression(enable bool) Option {
 	}
 }
 
+// WithLogger sets the logger used for WebSocket frame and protocol errors.
+// WithLogger는 WebSocket 프레임 및 프로토콜 오류를 기록할 로거를 설정합니다.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Config) {
+		c.Logger = l
+	}
+}
+
+// logError records a non-EOF error that ended a connection.
+func (c *Config) logError(conn net.Conn, err error) {
+	if err == nil || err == io.EOF {
+		return
+	}
+	l := c.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	l.Debug("websocket connection error", "remote_addr", conn.RemoteAddr(), "error", err)
+}
+
 func WithHeader(key, value string) Option {
 	return func(c *Config) {
 		if c.Header == nil {
@@ -157,6 +180,43 @@ func readHeaderZeroAlloc(br *bufio.Reader) (h ws.Header, err error) {
 	return h, err
 }
 
+// Server-side connection counters, maintained by Upgrade.
+var (
+	activeConns atomic.Int64
+	totalConns  atomic.Uint64
+)
+
+// ConnStats is a snapshot of server-side WebSocket connection counters.
+// ConnStats는 서버 측 WebSocket 연결 카운터의 스냅샷입니다.
+type ConnStats struct {
+	Active int64  // Upgraded connections that are still open.
+	Total  uint64 // Connections upgraded since the process started.
+}
+
+// Stats returns the current server-side WebSocket connection counters.
+// Stats는 현재 서버 측 WebSocket 연결 카운터를 반환합니다.
+func Stats() ConnStats {
+	return ConnStats{Active: activeConns.Load(), Total: totalConns.Load()}
+}
+
+// trackConn counts an upgraded connection until it closes.
+func trackConn(c net.Conn) {
+	totalConns.Add(1)
+	cc, ok := c.(interface {
+		AddCloseCallback(netpoll.CloseCallback) error
+	})
+	if !ok {
+		return
+	}
+	// Upgrade runs inside the request callback, so netpoll defers close
+	// callbacks until it returns and this one cannot be missed.
+	activeConns.Add(1)
+	_ = cc.AddCloseCallback(func(netpoll.Connection) error {
+		activeConns.Add(-1)
+		return nil
+	})
+}
+
 func Upgrade(w http.ResponseWriter, r *http.Request, handler Handler, opts ...Option) error {
 	cfg := &Config{
 		MaxFrameSize: DefaultMaxFrameSize,
@@ -217,12 +277,15 @@ func Upgrade(w http.ResponseWriter, r *http.Request, handler Handler, opts ...Op
 		return err
 	}
 
+	trackConn(conn)
 	handler.OnOpen(conn)
 	cfg.EnableCompression = compressionEnabled
 	assembler := NewAssembler(cfg)
 
 	hijacker.SetReadHandler(func(c net.Conn, rw *bufio.ReadWriter) error {
-		return ServeConn(c, rw, handler, cfg, assembler)
+		err := ServeConn(c, rw, handler, cfg, assembler)
+		cfg.logError(c, err)
+		return err
 	})
 
 	return nil